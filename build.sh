@@ -2,12 +2,14 @@
 
 set -e
 cd "$(dirname $0)"
+version="$(git describe --always --dirty 2>/dev/null || echo development)"
+ldflags="-X nocternity.net/go/monitoring/plugin.Version=$version"
 for arch in 386 amd64; do
 	mkdir -p bin/$arch
 	for d in $(find cmd -mindepth 1 -maxdepth 1 -type d); do
 		pushd $d >/dev/null
 		xn="$(basename "$d")"
-		GOARCH=$arch go build
+		GOARCH=$arch go build -ldflags "$ldflags"
 		/bin/mv "$xn" ../../bin/$arch
 		popd >/dev/null
 	done
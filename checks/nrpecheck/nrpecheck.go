@@ -0,0 +1,178 @@
+// Package nrpecheck implements a check that runs a command on a remote NRPE
+// server and reports its result.
+package nrpecheck
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"nocternity.net/go/monitoring/nrpe"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// A function that sends a query to a NRPE server.
+type queryFunc func(p *plugin.Plugin, client *nrpe.Client, command string, args []string) (*nrpe.Response, error)
+
+// Send a query using the NRPE client, within the plugin's timeout.
+func queryServer(p *plugin.Plugin, client *nrpe.Client, command string, args []string) (*nrpe.Response, error) {
+	return client.Query(p.Context(), command, args)
+}
+
+// Command line flags that have been parsed.
+type programFlags struct {
+	hostname      string // NRPE server - hostname
+	port          int    // NRPE server - port
+	command       string // Command to run
+	arguments     string // Command arguments, separated by '!'
+	noTLS         bool   // Do not use TLS
+	insecure      bool   // Do not verify the server's certificate
+	caFile        string // CA bundle used to verify the server's certificate
+	certFile      string // Client certificate
+	keyFile       string // Client certificate's key
+	packetVersion int    // Version of the NRPE packets
+}
+
+// Program data including configuration and runtime data.
+type checkProgram struct {
+	programFlags                // Flags from the command line
+	plugin       *plugin.Plugin // Plugin output state
+	query        queryFunc      // Function used to query the server
+	client       *nrpe.Client   // NRPE client
+	args         []string       // Command arguments
+}
+
+// Declare the command line flags.
+func (program *checkProgram) DeclareFlags(flags *plugin.Flags) {
+	flags.StringVarP(&program.hostname, 'H', "hostname", "", "Hostname of the NRPE server.")
+	flags.IntVarP(&program.port, 'P', "port", nrpe.DefaultPort, "Port number of the NRPE server.")
+	flags.StringVarP(&program.command, 'c', "command", "_NRPE_CHECK",
+		"Command to run. By default, the server's version is checked.")
+	flags.StringVarP(&program.arguments, 'a', "arguments", "",
+		"Arguments of the command, separated by '!' characters.")
+	flags.BoolVarP(&program.noTLS, 'n', "no-tls", false, "Do not use TLS.")
+	flags.BoolVar(&program.insecure, "insecure", false, "Do not verify the server's certificate.")
+	flags.StringVar(&program.caFile, "ca", "", "CA bundle used to verify the server's certificate.")
+	flags.StringVar(&program.certFile, "cert", "", "Client certificate.")
+	flags.StringVar(&program.keyFile, "key", "", "Private key of the client certificate.")
+	flags.IntVar(&program.packetVersion, "packet-version", nrpe.PACKET_VERSION_3,
+		"Version of the NRPE packets (2 or 3).")
+}
+
+// Build the TLS configuration from the flags.
+func (program *checkProgram) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: program.insecure}
+	if program.certFile != "" || program.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(program.certFile, program.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if program.caFile != "" {
+		data, err := ioutil.ReadFile(program.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", program.caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// Check the values that were specified from the command line. Returns true
+// if the arguments made sense.
+func (program *checkProgram) CheckFlags(p *plugin.Plugin) bool {
+	program.plugin = p
+	if program.hostname == "" {
+		program.plugin.SetState(plugin.UNKNOWN, "no hostname specified")
+		return false
+	}
+	if program.port < 1 || program.port > 65535 {
+		program.plugin.SetState(plugin.UNKNOWN, "invalid NRPE port number")
+		return false
+	}
+	if program.command == "" {
+		program.plugin.SetState(plugin.UNKNOWN, "no command specified")
+		return false
+	}
+	if program.packetVersion != nrpe.PACKET_VERSION_2 && program.packetVersion != nrpe.PACKET_VERSION_3 {
+		program.plugin.SetState(plugin.UNKNOWN, "unsupported NRPE packet version")
+		return false
+	}
+	program.client = &nrpe.Client{
+		Address: net.JoinHostPort(program.hostname, fmt.Sprintf("%d", program.port)),
+		Version: int16(program.packetVersion),
+	}
+	if !program.noTLS {
+		config, err := program.tlsConfig()
+		if err != nil {
+			program.plugin.SetState(plugin.UNKNOWN, err.Error())
+			return false
+		}
+		program.client.TLSConfig = config
+	}
+	if program.arguments != "" {
+		program.args = strings.Split(program.arguments, "!")
+	}
+	return true
+}
+
+// Convert a NRPE result code to a plugin status.
+func resultStatus(code int) plugin.Status {
+	if code < int(plugin.OK) || code > int(plugin.UNKNOWN) {
+		return plugin.UNKNOWN
+	}
+	return plugin.Status(code)
+}
+
+// Run the monitoring check. This implies querying the server, then copying
+// the remote command's output and performance data into the plugin's
+// output, using the result code returned by the server as the status.
+func (program *checkProgram) Run(p *plugin.Plugin) {
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "running %s on %s using NRPE v%d packets",
+		program.command, program.client.Address, program.packetVersion)
+	response, err := program.query(program.plugin, program.client, program.command, program.args)
+	if err != nil {
+		program.plugin.SetState(plugin.UNKNOWN, "NRPE query failed")
+		program.plugin.AddLine("%s", err)
+		return
+	}
+	program.plugin.Log(plugin.VERBOSE_DEBUG, "NRPE response (code %d):\n%s",
+		response.ResultCode, response.Output)
+	status := resultStatus(response.ResultCode)
+	result, err := plugin.ParseResult(response.Output)
+	message := result.Message
+	if result.Name != "" {
+		message = result.Name + ": " + message
+	}
+	program.plugin.SetState(status, message)
+	program.plugin.AddLines(result.Lines)
+	if err != nil {
+		program.plugin.AddLine("ignored remote performance data: %s", err)
+	}
+	for _, pd := range result.PerfData {
+		program.plugin.SetPerfData(pd)
+	}
+}
+
+// Name of the plugin, as displayed in its output.
+const Name = "NRPE check"
+
+// Command is the name under which the check is registered.
+const Command = "check_nrpe"
+
+// New creates an instance of the check.
+func New() plugin.Check {
+	return &checkProgram{query: queryServer}
+}
+
+func init() {
+	plugin.Register(Command, Name, New)
+}
@@ -0,0 +1,153 @@
+package nrpecheck
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nocternity.net/go/monitoring/nrpe"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// Create a query function that returns a fixed response or error.
+func fakeQuery(response *nrpe.Response, err error) queryFunc {
+	return func(p *plugin.Plugin, client *nrpe.Client, command string, args []string) (*nrpe.Response, error) {
+		if response != nil {
+			return &nrpe.Response{
+				ResultCode: response.ResultCode,
+				Output:     strings.ReplaceAll(response.Output, "$ARGS$", strings.Join(args, ",")),
+			}, nil
+		}
+		return nil, err
+	}
+}
+
+// Compare a plugin's rendered result with the contents of a golden file.
+func checkGolden(t *testing.T, name string, p *plugin.Plugin) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	got := p.Result().String() + "\n"
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output mismatch\n--- got ---\n%s--- want ---\n%s", got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	flags := programFlags{
+		hostname:      "remote.example.org",
+		port:          nrpe.DefaultPort,
+		command:       "check_cert",
+		arguments:     "www.example.org!443",
+		noTLS:         true,
+		packetVersion: nrpe.PACKET_VERSION_3,
+	}
+	badVersion := flags
+	badVersion.packetVersion = 4
+	tests := []struct {
+		name      string
+		flags     programFlags
+		response  *nrpe.Response
+		err       error
+		verbosity int
+	}{
+		{
+			name:  "no_hostname",
+			flags: programFlags{port: nrpe.DefaultPort, command: "check"},
+		},
+		{
+			name:  "bad_version",
+			flags: badVersion,
+		},
+		{
+			name:  "query_error",
+			flags: flags,
+			err:   errors.New("connection refused"),
+		},
+		{
+			name:  "remote_ok",
+			flags: flags,
+			response: &nrpe.Response{
+				ResultCode: 0,
+				Output: "Certificate check OK: certificate valid for $ARGS$ | validity=42;;;;\n" +
+					"[OK] all names present in SAN domain names",
+			},
+		},
+		{
+			name:  "remote_critical",
+			flags: flags,
+			response: &nrpe.Response{
+				ResultCode: 2,
+				Output:     "DISK CRITICAL - free space: / 12 MB (1%);| /=1000MB;800;900;0;1012",
+			},
+			verbosity: plugin.VERBOSE_DEBUG,
+		},
+		{
+			name:     "remote_invalid",
+			flags:    flags,
+			response: &nrpe.Response{ResultCode: 7, Output: "weird output | a=b c=1KiB"},
+		},
+		{
+			name:     "version",
+			flags:    programFlags{hostname: "remote", port: 5666, command: "_NRPE_CHECK", packetVersion: 2},
+			response: &nrpe.Response{ResultCode: 0, Output: "NRPE v4.0.3"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program := &checkProgram{programFlags: test.flags, query: fakeQuery(test.response, test.err)}
+			p := plugin.New(Name)
+			p.SetVerbosity(test.verbosity)
+			if program.CheckFlags(p) {
+				program.Run(p)
+			}
+			checkGolden(t, test.name, p)
+		})
+	}
+}
+
+func TestQueryServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &nrpe.Server{
+		AllowArguments: true,
+		Handler: func(command string, args []string) (int, string) {
+			return 1, "Remote WARNING: " + command + " " + strings.Join(args, " ") + " | x=1"
+		},
+	}
+	go server.Serve(listener)
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	result := plugin.RunCheck(Name, New(), []string{"-H", "127.0.0.1", "-P", port, "-n",
+		"-c", "check_thing", "-a", "a!b", "-t", "5"})
+	if got, want := result.String(), "NRPE check WARNING: Remote: check_thing a b | x=1;;;;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	client := &nrpe.Client{Address: listener.Addr().String()}
+	if _, err := client.Query(ctx, "check", nil); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,155 @@
+package sslcert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Load a bundle of PEM-encoded CA certificates into a certificate pool.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// Check whether a certificate is self-signed. The signature is checked
+// directly, as self-signed server certificates are usually not CAs.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// Find the certificate that issued a certificate among a list of
+// certificates.
+func findIssuer(cert *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range certs {
+		if candidate != cert && cert.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// Find the last certificate that can be reached by following issuers from
+// the first of the presented certificates, regardless of their order.
+func chainTop(certs []*x509.Certificate) *x509.Certificate {
+	top := certs[0]
+	for range certs {
+		issuer := findIssuer(top, certs)
+		if issuer == nil {
+			break
+		}
+		top = issuer
+	}
+	return top
+}
+
+// Check whether each of the presented certificates is followed by its
+// issuer.
+func isOrdered(certs []*x509.Certificate) bool {
+	for i := 1; i < len(certs); i++ {
+		if certs[i-1].CheckSignatureFrom(certs[i]) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify the presented certificates against the trusted roots. Expiry is
+// checked separately, so if verification fails because a certificate has
+// expired, it is attempted again at a time where that certificate was still
+// valid.
+func (program *checkProgram) verifyChain() ([]*x509.Certificate, error) {
+	certs := program.connState.PeerCertificates
+	opts := x509.VerifyOptions{
+		Roots:         program.roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	for {
+		chains, err := certs[0].Verify(opts)
+		if err == nil {
+			return chains[0], nil
+		}
+		var invalid x509.CertificateInvalidError
+		if !errors.As(err, &invalid) || invalid.Reason != x509.Expired ||
+			!invalid.Cert.NotAfter.Before(opts.CurrentTime) {
+			return nil, err
+		}
+		opts.CurrentTime = invalid.Cert.NotAfter
+	}
+}
+
+// Add a line describing a certificate, e.g. an element of the certificate
+// chain, its issuer and its time to expiry.
+func describeCertificate(p *plugin.Plugin, label string, cert *x509.Certificate) {
+	expiry := "expired"
+	if days := daysLeft(cert.NotAfter); days > 0 {
+		expiry = fmt.Sprintf("expires in %d days", days)
+	}
+	p.AddLine("%s: subject %s; issuer %s; %s", label, cert.Subject, cert.Issuer, expiry)
+}
+
+// Add lines describing the presented certificates and, if the chain could
+// be verified, the trusted root.
+func (program *checkProgram) describeChain() {
+	certs := program.connState.PeerCertificates
+	for i, cert := range certs {
+		describeCertificate(program.plugin, fmt.Sprintf("chain[%d]", i), cert)
+	}
+	if len(program.chain) == 0 {
+		return
+	}
+	root := program.chain[len(program.chain)-1]
+	for _, cert := range certs {
+		if cert.Equal(root) {
+			return
+		}
+	}
+	describeCertificate(program.plugin, "trusted root", root)
+}
+
+// Verify the certificate chain presented by the server, returning a status
+// code and description. Incomplete chains, chains with an untrusted root
+// and chains in the wrong order are reported separately.
+func (program *checkProgram) checkChain() (plugin.Status, string) {
+	certs := program.connState.PeerCertificates
+	chain, err := program.verifyChain()
+	program.chain = chain
+	program.describeChain()
+	if err == nil {
+		if !isOrdered(certs) {
+			return plugin.WARNING, "certificate chain is in the wrong order"
+		}
+		return plugin.OK, "certificate chain is valid"
+	}
+	program.plugin.Log(plugin.VERBOSE_INFO, "chain verification: %v", err)
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(err, &unknown) {
+		program.plugin.AddLine("chain verification error: %v", err)
+		return plugin.CRITICAL, "certificate chain is invalid"
+	}
+	top := chainTop(certs)
+	if isSelfSigned(top) {
+		program.plugin.AddLine("untrusted root %s", top.Subject)
+		return plugin.CRITICAL, "certificate chain has an untrusted root"
+	}
+	program.plugin.AddLine("missing issuer certificate %s", top.Issuer)
+	return plugin.CRITICAL, "certificate chain is incomplete"
+}
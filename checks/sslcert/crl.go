@@ -0,0 +1,149 @@
+package sslcert
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Maximal size of a CRL downloaded from a distribution point.
+const maxCRLSize = 64 << 20
+
+// Download a CRL using HTTP.
+func fetchCRL(ctx context.Context, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxCRLSize))
+}
+
+// Load a CRL from a distribution point, which may be either a HTTP(S) URL, a
+// file URL or the path to a local file.
+func loadCRL(ctx context.Context, location string) (*pkix.CertificateList, error) {
+	var (
+		data []byte
+		err  error
+	)
+	u, perr := url.Parse(location)
+	switch {
+	case perr == nil && (u.Scheme == "http" || u.Scheme == "https"):
+		data, err = fetchCRL(ctx, location)
+	case perr == nil && u.Scheme == "file":
+		data, err = ioutil.ReadFile(u.Path)
+	case perr == nil && u.Scheme != "":
+		err = fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	default:
+		data, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCRL(data)
+}
+
+// Get the locations from which the CRL may be loaded: the file specified on
+// the command line, or the certificate's distribution points.
+func (program *checkProgram) crlLocations() []string {
+	if program.crlFile != "" {
+		return []string{program.crlFile}
+	}
+	return program.certificate.CRLDistributionPoints
+}
+
+// Load the CRL from the first location that works. Errors are added to the
+// plugin's output.
+func (program *checkProgram) getCRL(locations []string) (*pkix.CertificateList, bool) {
+	for _, location := range locations {
+		program.plugin.Log(plugin.VERBOSE_CONFIG, "loading CRL from %s", location)
+		crl, err := loadCRL(program.plugin.Context(), location)
+		if err == nil {
+			return crl, true
+		}
+		program.plugin.AddLine("could not load CRL from %s: %v", location, err)
+	}
+	return nil, false
+}
+
+// Check the time left until the CRL's next update against the CRL
+// thresholds, returning a status code and description. The time left is
+// added to the plugin's performance data. Stale CRLs cause a warning.
+func (program *checkProgram) checkCRLFreshness(crl *pkix.CertificateList) (plugin.Status, string) {
+	nextUpdate := crl.TBSCertList.NextUpdate
+	if nextUpdate.IsZero() {
+		return plugin.OK, "certificate not revoked (CRL)"
+	}
+	hours := int(nextUpdate.Sub(time.Now()) / time.Hour)
+	pdat := perfdata.NewInt("crl_validity", perfdata.UOM_NONE, int64(hours))
+	state := program.crlThresholds.Evaluate(float64(hours), pdat)
+	program.plugin.AddPerfData(pdat)
+	if !nextUpdate.After(time.Now()) {
+		if state == plugin.OK {
+			state = plugin.WARNING
+		}
+		return state, "CRL is stale"
+	}
+	var limitStr string
+	switch state {
+	case plugin.CRITICAL:
+		limitStr = fmt.Sprintf(" (critical threshold %s)", program.crlThresholds.Crit)
+	case plugin.WARNING:
+		limitStr = fmt.Sprintf(" (warning threshold %s)", program.crlThresholds.Warn)
+	}
+	return state, fmt.Sprintf("certificate not revoked (CRL), next update in %d hours%s",
+		hours, limitStr)
+}
+
+// Check the revocation status of the server's certificate using its
+// issuer's CRL, returning a status code and description. False is returned
+// if CRL checks are disabled.
+func (program *checkProgram) checkCRL() (plugin.Status, string, bool) {
+	if !program.crlCheck && program.crlFile == "" {
+		return plugin.OK, "", false
+	}
+	issuer := program.leafIssuer()
+	if issuer == nil {
+		return plugin.UNKNOWN, "CRL check impossible without the issuer's certificate", true
+	}
+	locations := program.crlLocations()
+	if len(locations) == 0 {
+		return plugin.UNKNOWN, "certificate does not list CRL distribution points", true
+	}
+	crl, ok := program.getCRL(locations)
+	if !ok {
+		return plugin.UNKNOWN, "could not load CRL", true
+	}
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		program.plugin.AddLine("CRL signature error: %v", err)
+		return plugin.CRITICAL, "invalid CRL signature", true
+	}
+	program.plugin.Log(plugin.VERBOSE_INFO, "CRL: issuer %s, this update %s, next update %s, %d revoked certificates",
+		crl.TBSCertList.Issuer, crl.TBSCertList.ThisUpdate.Format(time.RFC3339),
+		crl.TBSCertList.NextUpdate.Format(time.RFC3339), len(crl.TBSCertList.RevokedCertificates))
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(program.certificate.SerialNumber) == 0 {
+			program.plugin.AddLine("certificate revoked on %s",
+				revoked.RevocationTime.Format(time.RFC3339))
+			return plugin.CRITICAL, "certificate revoked (CRL)", true
+		}
+	}
+	status, message := program.checkCRLFreshness(crl)
+	return status, message, true
+}
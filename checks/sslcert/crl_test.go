@@ -0,0 +1,177 @@
+package sslcert
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Create a CRL signed by a test CA which lists the specified serial numbers.
+func makeCRL(issuer *testIssuer, nextUpdate time.Time, serials ...*big.Int) []byte {
+	revoked := make([]pkix.RevokedCertificate, len(serials))
+	for i, serial := range serials {
+		revoked[i] = pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+	}
+	data, err := issuer.certificate.CreateCRL(rand.Reader, issuer.key, revoked,
+		time.Now().Add(-time.Hour), nextUpdate)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// Create a certificate issued by the test intermediate CA that lists a CRL
+// distribution point.
+func makeCRLCertificate(location string) *x509.Certificate {
+	template := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.org"},
+		DNSNames: []string{"example.org"},
+	}
+	if location != "" {
+		template.CRLDistributionPoints = []string{location}
+	}
+	return issueCertificate(testIntermediate, template, 30).certificate
+}
+
+func TestCRL(t *testing.T) {
+	crls := make(map[string][]byte)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := crls[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+	baseURL := "http://" + server.Listener.Addr().String()
+
+	good := makeCRLCertificate("")
+	revoked := makeCRLCertificate(baseURL + "/revoked.crl")
+	fresh := time.Now().Add(48*time.Hour + 30*time.Minute)
+	for path, data := range map[string][]byte{
+		"/good.crl":      makeCRL(testIntermediate, fresh, big.NewInt(1234)),
+		"/revoked.crl":   makeCRL(testIntermediate, fresh, revoked.SerialNumber),
+		"/stale.crl":     makeCRL(testIntermediate, time.Now().Add(-time.Minute)),
+		"/untrusted.crl": makeCRL(untrustedCA, fresh),
+	} {
+		crls[path] = data
+	}
+	server.Start()
+
+	dir := t.TempDir()
+	crlFile := filepath.Join(dir, "revoked.crl")
+	if err := ioutil.WriteFile(crlFile, crls["/revoked.crl"], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := func(cert *x509.Certificate) []*x509.Certificate {
+		return []*x509.Certificate{cert, testIntermediate.certificate}
+	}
+	tests := []struct {
+		name  string
+		flags programFlags
+		cert  *x509.Certificate
+	}{
+		{
+			name:  "crl_good",
+			flags: programFlags{crlCheck: true},
+			cert:  makeCRLCertificate(baseURL + "/good.crl"),
+		},
+		{
+			name:  "crl_revoked",
+			flags: programFlags{crlCheck: true},
+			cert:  revoked,
+		},
+		{
+			name:  "crl_stale",
+			flags: programFlags{crlCheck: true},
+			cert:  makeCRLCertificate(baseURL + "/stale.crl"),
+		},
+		{
+			name:  "crl_warning",
+			flags: programFlags{crlCheck: true, crlWarn: "72:", crlCrit: "24:"},
+			cert:  makeCRLCertificate(baseURL + "/good.crl"),
+		},
+		{
+			name:  "crl_untrusted",
+			flags: programFlags{crlCheck: true},
+			cert:  makeCRLCertificate(baseURL + "/untrusted.crl"),
+		},
+		{
+			name:  "crl_file",
+			flags: programFlags{crlFile: crlFile},
+			cert:  revoked,
+		},
+		{
+			name:  "crl_file_url",
+			flags: programFlags{crlCheck: true},
+			cert:  makeCRLCertificate("file://" + filepath.ToSlash(filepath.Join(dir, "revoked.crl"))),
+		},
+		{
+			name:  "crl_no_points",
+			flags: programFlags{crlCheck: true},
+			cert:  good,
+		},
+		{
+			name:  "crl_disabled",
+			flags: programFlags{},
+			cert:  makeCRLCertificate(baseURL + "/revoked.crl"),
+		},
+		{
+			name:  "crl_range_invalid",
+			flags: programFlags{crlCheck: true, crlCrit: "x"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.flags.hostname = "example.org"
+			test.flags.port = 443
+			test.flags.warn = -1
+			test.flags.crit = -1
+			program := &checkProgram{programFlags: test.flags, roots: testRoots()}
+			p := plugin.New(Name)
+			if program.CheckFlags(p) {
+				program.getter = fakeGetter{certificates: chain(test.cert)}
+				program.Run(p)
+			}
+			checkGolden(t, test.name, p)
+		})
+	}
+}
+
+func TestCRLFetchError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	program := &checkProgram{
+		programFlags: programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, crlCheck: true},
+		roots:        testRoots(),
+	}
+	p := plugin.New(Name)
+	if !program.CheckFlags(p) {
+		t.Fatalf("unexpected flag error: %s", p.Result())
+	}
+	cert := makeCRLCertificate(server.URL + "/missing.crl")
+	program.getter = fakeGetter{certificates: []*x509.Certificate{cert, testIntermediate.certificate}}
+	program.Run(p)
+	r := p.Result()
+	if r.Status != plugin.UNKNOWN || r.Message != "could not load CRL" {
+		t.Errorf("unexpected result %s", r)
+	}
+	if output := r.String(); !strings.Contains(output, "/missing.crl: HTTP status 404") {
+		t.Errorf("missing error in output %s", output)
+	}
+}
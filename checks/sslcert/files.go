@@ -0,0 +1,373 @@
+package sslcert
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Errors returned when a file does not contain certificates.
+var (
+	errNoCertificates = errors.New("no certificates found")
+	errOnlyPEMKeys    = errors.New("PEM file without certificates")
+)
+
+// Extract the certificates from PEM data. Blocks that do not contain
+// certificates, e.g. private keys, are ignored.
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" && block.Type != "TRUSTED CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errOnlyPEMKeys
+	}
+	return certs, nil
+}
+
+// Extract the certificates from a PKCS#12 archive.
+func parsePKCS12Certificates(data []byte, password string) ([]*x509.Certificate, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, block := range blocks {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errNoCertificates
+	}
+	return certs, nil
+}
+
+// Load the certificates from a file, which may contain PEM-encoded
+// certificates, DER-encoded certificates or a PKCS#12 archive. PKCS#12
+// archives that use PBES2 encryption, which is the default in OpenSSL 3,
+// are not supported.
+func loadCertificateFile(path, password string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("-----BEGIN ")) {
+		return parsePEMCertificates(data)
+	}
+	if certs, err := x509.ParseCertificates(data); err == nil && len(certs) != 0 {
+		return certs, nil
+	}
+	certs, err := parsePKCS12Certificates(data, password)
+	if err == pkcs12.ErrIncorrectPassword || err == errNoCertificates {
+		return nil, err
+	}
+	if _, ok := err.(pkcs12.NotImplementedError); ok {
+		return nil, fmt.Errorf("%v (only PKCS#12 files that use legacy encryption are supported)", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("not a PEM, DER or PKCS#12 file: %v", err)
+	}
+	return certs, nil
+}
+
+// Expand the patterns into a sorted list of files. Directories are replaced
+// with the files they contain.
+func expandPatterns(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match '%s'", pattern)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.IsDir() {
+				add(match)
+				continue
+			}
+			entries, err := ioutil.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					add(filepath.Join(match, entry.Name()))
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+//--------------------------------------------------------------------------------------------------------
+
+// Command line flags of the certificate file check.
+type fileFlags struct {
+	files        string   // Comma-separated list of files and patterns
+	warn         int      // Threshold for warning state (days)
+	crit         int      // Threshold for critical state (days)
+	warnRange    string   // Range for warning state
+	critRange    string   // Range for critical state
+	hostname     string   // Host name the certificates should match
+	ignoreCnOnly bool     // Do not warn about SAN-less certificates
+	names        string   // Comma-separated list of extra names
+	extraNames   []string // Extra names the certificates should include
+	passwordFile string   // File that contains the PKCS#12 password
+	ignoreRoot   bool     // Do not check the expiry of self-signed CAs
+}
+
+// A certificate that was loaded from a file.
+type fileCertificate struct {
+	path        string            // Path to the file
+	index       int               // Position of the certificate in the file
+	certificate *x509.Certificate // The certificate
+}
+
+// Certificate file check, including configuration and runtime data.
+type fileProgram struct {
+	fileFlags                      // Flags from the command line
+	plugin       *plugin.Plugin    // Plugin output state
+	thresholds   plugin.Thresholds // Warning and critical ranges
+	password     string            // PKCS#12 password
+	paths        []string          // Files to check
+	certificates []fileCertificate // Certificates loaded from the files
+}
+
+// Declare the command line flags.
+func (program *fileProgram) DeclareFlags(flags *plugin.Flags) {
+	flags.StringVarP(&program.files, 'f', "files", "",
+		"A comma-separated list of certificate files, directories or glob patterns.")
+	flags.IntVarP(&program.warn, 'W', "warning", -1,
+		"Validity threshold below which a warning state is issued, in days.")
+	flags.IntVarP(&program.crit, 'C', "critical", -1,
+		"Validity threshold below which a critical state is issued, in days.")
+	flags.StringVarP(&program.warnRange, 'w', "warning-range", "",
+		"Validity range outside of which a warning state is issued, in days.")
+	flags.StringVarP(&program.critRange, 'c', "critical-range", "",
+		"Validity range outside of which a critical state is issued, in days.")
+	flags.StringVarP(&program.hostname, 'H', "hostname", "",
+		"Host name that the first certificate of each file should provide.")
+	flags.BoolVar(&program.ignoreCnOnly, "ignore-cn-only", false,
+		"Do not issue warnings regarding certificates that do not provide SANs.")
+	flags.StringVarP(&program.names, 'a', "additional-names", "",
+		"A comma-separated list of names that the first certificate of each file should "+
+			"also provide.")
+	flags.StringVar(&program.passwordFile, "password-file", "",
+		"File that contains the password of PKCS#12 archives.")
+	flags.BoolVar(&program.ignoreRoot, "ignore-root-expiry", false,
+		"Do not check the time to expiry of self-signed CA certificates.")
+}
+
+// Check the values that were specified from the command line. Returns true
+// if the arguments made sense.
+func (program *fileProgram) CheckFlags(p *plugin.Plugin) bool {
+	program.plugin = p
+	if program.files == "" {
+		program.plugin.SetState(plugin.UNKNOWN, "no files specified")
+		return false
+	}
+	if program.warn != -1 && program.crit != -1 && program.warn <= program.crit {
+		program.plugin.SetState(plugin.UNKNOWN, "nonsensical thresholds")
+		return false
+	}
+	var ok bool
+	program.thresholds.Warn, ok = getThreshold(p, "warning", program.warn, program.warnRange)
+	if !ok {
+		return false
+	}
+	program.thresholds.Crit, ok = getThreshold(p, "critical", program.crit, program.critRange)
+	if !ok {
+		return false
+	}
+	if program.passwordFile != "" {
+		data, err := ioutil.ReadFile(program.passwordFile)
+		if err != nil {
+			program.plugin.SetState(plugin.UNKNOWN, fmt.Sprintf("could not read password: %v", err))
+			return false
+		}
+		program.password = strings.TrimRight(string(data), "\r\n")
+	}
+	paths, err := expandPatterns(strings.Split(program.files, ","))
+	if err != nil {
+		program.plugin.SetState(plugin.UNKNOWN, err.Error())
+		return false
+	}
+	program.paths = paths
+	program.hostname = strings.ToLower(program.hostname)
+	program.extraNames = splitNames(program.names)
+	return true
+}
+
+// Load the certificates from all files, returning a status code and
+// description. Files that cannot be read or parsed are reported; PEM files
+// that only contain keys are ignored.
+func (program *fileProgram) loadFiles() (plugin.Status, string) {
+	failed := 0
+	for _, path := range program.paths {
+		certs, err := loadCertificateFile(path, program.password)
+		if err == errOnlyPEMKeys {
+			program.plugin.Log(plugin.VERBOSE_INFO, "%s: no certificates", path)
+			continue
+		}
+		if err != nil {
+			program.plugin.AddLine("%s: %v", path, err)
+			failed++
+			continue
+		}
+		for i, cert := range certs {
+			program.certificates = append(program.certificates, fileCertificate{path, i, cert})
+		}
+	}
+	if failed != 0 {
+		return plugin.UNKNOWN, fmt.Sprintf("could not load %d file(s)", failed)
+	}
+	return plugin.OK, fmt.Sprintf("%d certificate(s) loaded from %d file(s)",
+		len(program.certificates), len(program.paths))
+}
+
+// Ensure that the first certificate of each file matches the specified
+// names in the same way as the network check, returning the status code and
+// description of the file that is in the worst state.
+func (program *fileProgram) checkNames() (plugin.Status, string) {
+	status, message := plugin.OK, ""
+	checked := false
+	for _, fc := range program.certificates {
+		if fc.index != 0 {
+			continue
+		}
+		s, m := checkCertificateNames(program.plugin, fc.certificate, program.hostname,
+			program.extraNames, program.ignoreCnOnly, "certificate from "+fc.path)
+		if !checked || s.Worse(status) {
+			status, message, checked = s, m, true
+		}
+	}
+	return status, message
+}
+
+// Generate the performance data label for a certificate. The file's name is
+// used, unless another file with the same name is being checked. If the
+// label is already used, e.g. by a file whose name ends with the index of
+// another file's certificate, a number is appended to it.
+func (program *fileProgram) label(fc fileCertificate, baseNames map[string]int, used map[string]bool) string {
+	label := filepath.Base(fc.path)
+	if baseNames[label] > 1 {
+		label = fc.path
+	}
+	if fc.index != 0 {
+		label = fmt.Sprintf("%s_%d", label, fc.index)
+	}
+	unique := label
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s#%d", label, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// Check the time to expiry of all certificates, returning the status and
+// description of the certificate that is in the worst state or, among
+// certificates that are in the same state, the closest to expiry. A line
+// describing each certificate is added to the output.
+func (program *fileProgram) checkExpiry() (plugin.Status, string) {
+	baseNames := make(map[string]int)
+	for _, path := range program.paths {
+		baseNames[filepath.Base(path)]++
+	}
+	used := make(map[string]bool)
+	var results []expiryResult
+	for _, fc := range program.certificates {
+		cert := fc.certificate
+		location := fc.path
+		if fc.index != 0 {
+			location = fmt.Sprintf("%s[%d]", fc.path, fc.index)
+		}
+		describeCertificate(program.plugin, location, cert)
+		if isIgnoredRoot(cert, fc.index, program.ignoreRoot) {
+			continue
+		}
+		name := fmt.Sprintf("certificate %s in %s", cert.Subject, location)
+		results = append(results, evaluateExpiry(program.plugin, program.thresholds, cert,
+			program.label(fc, baseNames, used), name))
+	}
+	return worstExpiry(results)
+}
+
+// Run the check: load the certificates, check their names if necessary,
+// then check their time to expiry.
+func (program *fileProgram) Run(p *plugin.Plugin) {
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "thresholds: %s", program.thresholds)
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "files: %s", strings.Join(program.paths, ", "))
+	status, message := program.loadFiles()
+	if len(program.certificates) == 0 {
+		if status == plugin.OK {
+			program.plugin.SetState(plugin.UNKNOWN, "no certificates found")
+		} else {
+			program.plugin.SetState(status, message)
+		}
+		return
+	}
+	if status != plugin.OK {
+		program.plugin.AddResult(status, message)
+	}
+	if program.hostname != "" || len(program.extraNames) != 0 {
+		program.plugin.AddResult(program.checkNames())
+	}
+	program.plugin.AddResult(program.checkExpiry())
+}
+
+// FileName is the name of the certificate file check, as displayed in its
+// output.
+const FileName = "Certificate file check"
+
+// FileCommand is the name under which the certificate file check is
+// registered.
+const FileCommand = "check_certificate_file"
+
+// NewFileCheck creates an instance of the certificate file check.
+func NewFileCheck() plugin.Check {
+	return &fileProgram{}
+}
+
+func init() {
+	plugin.Register(FileCommand, FileName, NewFileCheck)
+}
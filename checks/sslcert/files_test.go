@@ -0,0 +1,201 @@
+package sslcert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Write PEM-encoded certificates to a file.
+func writePEM(t *testing.T, path string, certs ...*x509.Certificate) {
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Create a directory that contains certificates in various formats.
+func makeCertificateDir(t *testing.T) string {
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, "leaf.pem"), makeCertificate(testIntermediate, "example.org", 30, "example.org"))
+	writePEM(t, filepath.Join(dir, "fullchain.pem"),
+		makeCertificate(testIntermediate, "www.example.org", 8, "www.example.org"),
+		testIntermediate.certificate, testRoot.certificate)
+	der := makeCertificate(testIntermediate, "mail.example.org", 60, "mail.example.org").Raw
+	if err := ioutil.WriteFile(filepath.Join(dir, "mail.der"), der, 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("not really a key")})
+	if err := ioutil.WriteFile(filepath.Join(dir, "leaf.key"), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "bad"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad", "garbage.txt"), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "cn"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "cn", "cn_only.pem"), makeCertificate(testIntermediate, "example.org", 30))
+	return dir
+}
+
+func TestFileGolden(t *testing.T) {
+	dir := makeCertificateDir(t)
+	in := func(names ...string) string {
+		for i, name := range names {
+			names[i] = filepath.Join(dir, name)
+		}
+		return strings.Join(names, ",")
+	}
+	tests := []struct {
+		name  string
+		flags fileFlags
+	}{
+		{
+			name:  "files_none",
+			flags: fileFlags{warn: -1, crit: -1},
+		},
+		{
+			name:  "files_no_match",
+			flags: fileFlags{files: in("*.crt"), warn: -1, crit: -1},
+		},
+		{
+			name:  "files_single",
+			flags: fileFlags{files: in("leaf.pem"), warn: 10, crit: 5},
+		},
+		{
+			name:  "files_glob",
+			flags: fileFlags{files: in("*.pem", "mail.der"), warn: 10, crit: 5},
+		},
+		{
+			name:  "files_directory",
+			flags: fileFlags{files: dir, warn: 10, crit: 5, ignoreRoot: true},
+		},
+		{
+			name:  "files_keys_only",
+			flags: fileFlags{files: in("leaf.key"), warn: -1, crit: -1},
+		},
+		{
+			name:  "files_bad",
+			flags: fileFlags{files: in("bad/garbage.txt", "leaf.pem"), warn: -1, crit: -1},
+		},
+		{
+			name:  "files_names",
+			flags: fileFlags{files: in("leaf.pem", "mail.der"), warn: -1, crit: -1, names: "Example.org"},
+		},
+		{
+			name: "files_hostname",
+			flags: fileFlags{
+				files: in("leaf.pem", "mail.der"), warn: -1, crit: -1,
+				hostname: "example.org", names: "www.example.org",
+			},
+		},
+		{
+			name:  "files_cn_only",
+			flags: fileFlags{files: in("cn/cn_only.pem", "leaf.pem"), warn: -1, crit: -1, hostname: "example.org"},
+		},
+		{
+			name: "files_cn_only_ignored",
+			flags: fileFlags{
+				files: in("cn/cn_only.pem", "leaf.pem"), warn: -1, crit: -1,
+				hostname: "Example.org", ignoreCnOnly: true,
+			},
+		},
+		{
+			name:  "files_range",
+			flags: fileFlags{files: in("leaf.pem"), warn: -1, crit: -1, warnRange: "40:", critRange: "20:"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program := &fileProgram{fileFlags: test.flags}
+			p := plugin.New(FileName)
+			if program.CheckFlags(p) {
+				program.Run(p)
+			}
+			output := strings.ReplaceAll(p.Result().String(), dir, "TESTDIR")
+			compareGolden(t, test.name, output+"\n")
+		})
+	}
+}
+
+func TestFilePKCS12(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	program := &fileProgram{fileFlags: fileFlags{
+		files: filepath.Join("testdata", "keystore.p12"), warn: -1, crit: -1,
+		passwordFile: passwordFile, names: "keystore.example.org",
+	}}
+	p := plugin.New(FileName)
+	if !program.CheckFlags(p) {
+		t.Fatalf("unexpected flag error: %s", p.Result())
+	}
+	program.Run(p)
+	r := p.Result()
+	if r.Status != plugin.OK || len(program.certificates) != 2 {
+		t.Fatalf("unexpected result %s", r)
+	}
+	if !strings.Contains(r.String(), "keystore.p12: subject CN=keystore.example.org; issuer CN=Keystore Test CA") {
+		t.Errorf("leaf certificate not described in %s", r)
+	}
+
+	program = &fileProgram{fileFlags: fileFlags{
+		files: filepath.Join("testdata", "keystore.p12"), warn: -1, crit: -1,
+	}}
+	p = plugin.New(FileName)
+	if !program.CheckFlags(p) {
+		t.Fatalf("unexpected flag error: %s", p.Result())
+	}
+	program.Run(p)
+	if r := p.Result(); r.Status != plugin.UNKNOWN {
+		t.Errorf("unexpected result without password %s", r)
+	}
+}
+
+func TestFilePKCS12Unsupported(t *testing.T) {
+	certs, err := loadCertificateFile(filepath.Join("testdata", "modern.p12"), "secret")
+	if err == nil || certs != nil {
+		t.Fatalf("unexpected success loading a PBES2 archive")
+	}
+	if !strings.Contains(err.Error(), "unknown digest algorithm") || !strings.Contains(err.Error(), "legacy") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFileLabelCollision(t *testing.T) {
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, "x.pem"),
+		makeCertificate(testIntermediate, "a.example.org", 30, "a.example.org"), testIntermediate.certificate)
+	writePEM(t, filepath.Join(dir, "x.pem_1"), makeCertificate(testIntermediate, "b.example.org", 40, "b.example.org"))
+	program := &fileProgram{fileFlags: fileFlags{files: dir, warn: -1, crit: -1}}
+	p := plugin.New(FileName)
+	if !program.CheckFlags(p) {
+		t.Fatalf("unexpected flag error: %s", p.Result())
+	}
+	program.Run(p)
+	r := p.Result()
+	if r.Status != plugin.OK {
+		t.Fatalf("unexpected result %s", r)
+	}
+	var labels []string
+	for _, pd := range r.PerfData {
+		labels = append(labels, pd.Label)
+	}
+	if got, want := strings.Join(labels, " "), "x.pem x.pem_1 x.pem_1#2"; got != want {
+		t.Errorf("got labels %q, want %q", got, want)
+	}
+}
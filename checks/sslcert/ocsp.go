@@ -0,0 +1,167 @@
+package sslcert
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"nocternity.net/go/monitoring/perfdata"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Identifier of the TLS feature extension, which is used to mark
+// certificates that require OCSP stapling (RFC 7633).
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// TLS feature that corresponds to the status_request extension.
+const tlsFeatureStatusRequest = 5
+
+// Maximal size of a response from an OCSP responder.
+const maxOCSPResponseSize = 1 << 20
+
+// Check whether a certificate requires OCSP stapling.
+func mustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			if feature == tlsFeatureStatusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Find the certificate that issued the server's certificate, using the
+// verified chain if it is available.
+func (program *checkProgram) leafIssuer() *x509.Certificate {
+	if len(program.chain) > 1 {
+		return program.chain[1]
+	}
+	return findIssuer(program.certificate, program.connState.PeerCertificates)
+}
+
+// Query the OCSP responder listed in a certificate's AIA extension.
+func queryOCSPResponder(ctx context.Context, cert, issuer *x509.Certificate) ([]byte, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, errors.New("certificate does not list an OCSP responder")
+	}
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cert.OCSPServer[0], bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder returned HTTP status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+}
+
+// Get the OCSP response for the server's certificate, either from the
+// handshake or, if it was not stapled and querying is enabled, from the
+// OCSP responder. Returns a nil response if neither source is available.
+func (program *checkProgram) getOCSPResponse(issuer *x509.Certificate) ([]byte, string, error) {
+	if len(program.connState.OCSPResponse) != 0 {
+		return program.connState.OCSPResponse, "stapled", nil
+	}
+	if !program.ocspQuery {
+		return nil, "", nil
+	}
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "querying OCSP responder %v", program.certificate.OCSPServer)
+	data, err := queryOCSPResponder(program.plugin.Context(), program.certificate, issuer)
+	return data, "responder", err
+}
+
+// Check the time left until the OCSP response's next update against the
+// OCSP thresholds, returning a status code and description. The time left
+// is added to the plugin's performance data.
+func (program *checkProgram) checkOCSPFreshness(response *ocsp.Response, source string) (plugin.Status, string) {
+	if response.NextUpdate.IsZero() {
+		return plugin.OK, fmt.Sprintf("OCSP status is good (%s)", source)
+	}
+	hours := int(response.NextUpdate.Sub(time.Now()) / time.Hour)
+	pdat := perfdata.NewInt("ocsp_validity", perfdata.UOM_NONE, int64(hours))
+	state := program.ocspThresholds.Evaluate(float64(hours), pdat)
+	program.plugin.AddPerfData(pdat)
+	if !response.NextUpdate.After(time.Now()) {
+		return plugin.CRITICAL, fmt.Sprintf("OCSP response is stale (%s)", source)
+	}
+	var limitStr string
+	switch state {
+	case plugin.CRITICAL:
+		limitStr = fmt.Sprintf(" (critical threshold %s)", program.ocspThresholds.Crit)
+	case plugin.WARNING:
+		limitStr = fmt.Sprintf(" (warning threshold %s)", program.ocspThresholds.Warn)
+	}
+	return state, fmt.Sprintf("OCSP status is good (%s), next update in %d hours%s",
+		source, hours, limitStr)
+}
+
+// Check the revocation status of the server's certificate using OCSP,
+// returning a status code and description. If no OCSP response is
+// available, false is returned unless the certificate requires stapling.
+func (program *checkProgram) checkOCSP() (plugin.Status, string, bool) {
+	staple := mustStaple(program.certificate)
+	if staple && len(program.connState.OCSPResponse) == 0 {
+		return plugin.CRITICAL, "certificate requires OCSP stapling but no response was stapled", true
+	}
+	issuer := program.leafIssuer()
+	if issuer == nil {
+		if len(program.connState.OCSPResponse) == 0 && !program.ocspQuery {
+			return plugin.OK, "", false
+		}
+		return plugin.UNKNOWN, "OCSP check impossible without the issuer's certificate", true
+	}
+	data, source, err := program.getOCSPResponse(issuer)
+	if err != nil {
+		program.plugin.AddLine("OCSP query error: %v", err)
+		return plugin.UNKNOWN, "could not query OCSP responder", true
+	}
+	if data == nil {
+		program.plugin.Log(plugin.VERBOSE_INFO, "no OCSP response stapled")
+		return plugin.OK, "", false
+	}
+	response, err := ocsp.ParseResponseForCert(data, program.certificate, issuer)
+	if err != nil {
+		program.plugin.AddLine("OCSP response error: %v", err)
+		return plugin.CRITICAL, fmt.Sprintf("invalid OCSP response (%s)", source), true
+	}
+	program.plugin.Log(plugin.VERBOSE_INFO, "OCSP response (%s): status %d, produced %s, this update %s, next update %s",
+		source, response.Status, response.ProducedAt.Format(time.RFC3339),
+		response.ThisUpdate.Format(time.RFC3339), response.NextUpdate.Format(time.RFC3339))
+	switch response.Status {
+	case ocsp.Good:
+		status, message := program.checkOCSPFreshness(response, source)
+		return status, message, true
+	case ocsp.Revoked:
+		program.plugin.AddLine("certificate revoked on %s (reason code %d)",
+			response.RevokedAt.Format(time.RFC3339), response.RevocationReason)
+		return plugin.CRITICAL, fmt.Sprintf("certificate revoked (%s)", source), true
+	default:
+		return plugin.WARNING, fmt.Sprintf("OCSP status is unknown (%s)", source), true
+	}
+}
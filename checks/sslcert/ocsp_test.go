@@ -0,0 +1,194 @@
+package sslcert
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Create an OCSP response for a certificate issued by the test intermediate
+// CA, valid until the specified time.
+func makeOCSPResponse(serial *big.Int, status int, nextUpdate time.Time) []byte {
+	template := ocsp.Response{
+		Status:       status,
+		SerialNumber: serial,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   nextUpdate,
+	}
+	if status == ocsp.Revoked {
+		template.RevokedAt = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		template.RevocationReason = ocsp.KeyCompromise
+	}
+	data, err := ocsp.CreateResponse(testIntermediate.certificate, testIntermediate.certificate,
+		template, testIntermediate.key)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// OCSP responder stub which answers with the statuses associated with the
+// certificates' serial numbers. Unlisted certificates are unknown.
+type ocspResponder struct {
+	statuses map[int64]int
+}
+
+func (r *ocspResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request, err := ocsp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status, ok := r.statuses[request.SerialNumber.Int64()]
+	if !ok {
+		status = ocsp.Unknown
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(makeOCSPResponse(request.SerialNumber, status, time.Now().Add(48*time.Hour+30*time.Minute)))
+}
+
+// Create a certificate issued by the test intermediate CA that lists an
+// OCSP responder and may require stapling.
+func makeOCSPCertificate(responder string, staple bool) *x509.Certificate {
+	template := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.org"},
+		DNSNames: []string{"example.org"},
+	}
+	if responder != "" {
+		template.OCSPServer = []string{responder}
+	}
+	if staple {
+		value, err := asn1.Marshal([]int{tlsFeatureStatusRequest})
+		if err != nil {
+			panic(err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: oidTLSFeature, Value: value}}
+	}
+	return issueCertificate(testIntermediate, template, 30).certificate
+}
+
+func TestOCSP(t *testing.T) {
+	responder := &ocspResponder{statuses: make(map[int64]int)}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	good := makeOCSPCertificate(server.URL, false)
+	responder.statuses[good.SerialNumber.Int64()] = ocsp.Good
+	revoked := makeOCSPCertificate(server.URL, false)
+	responder.statuses[revoked.SerialNumber.Int64()] = ocsp.Revoked
+	unknown := makeOCSPCertificate(server.URL, false)
+	noResponder := makeOCSPCertificate("", false)
+	staple := makeOCSPCertificate("", true)
+	fresh := time.Now().Add(48*time.Hour + 30*time.Minute)
+
+	chain := func(cert *x509.Certificate) []*x509.Certificate {
+		return []*x509.Certificate{cert, testIntermediate.certificate}
+	}
+	tests := []struct {
+		name   string
+		flags  programFlags
+		getter certGetter
+	}{
+		{
+			name:  "ocsp_stapled_good",
+			flags: programFlags{},
+			getter: fakeGetter{
+				certificates: chain(good),
+				ocspResponse: makeOCSPResponse(good.SerialNumber, ocsp.Good, fresh),
+			},
+		},
+		{
+			name:  "ocsp_stapled_revoked",
+			flags: programFlags{},
+			getter: fakeGetter{
+				certificates: chain(revoked),
+				ocspResponse: makeOCSPResponse(revoked.SerialNumber, ocsp.Revoked, fresh),
+			},
+		},
+		{
+			name:  "ocsp_stapled_stale",
+			flags: programFlags{},
+			getter: fakeGetter{
+				certificates: chain(good),
+				ocspResponse: makeOCSPResponse(good.SerialNumber, ocsp.Good, time.Now().Add(-time.Minute)),
+			},
+		},
+		{
+			name:  "ocsp_stapled_invalid",
+			flags: programFlags{},
+			getter: fakeGetter{
+				certificates: chain(good),
+				ocspResponse: []byte("not an OCSP response"),
+			},
+		},
+		{
+			name:   "ocsp_must_staple",
+			flags:  programFlags{ocspQuery: true},
+			getter: fakeGetter{certificates: chain(staple)},
+		},
+		{
+			name:   "ocsp_not_queried",
+			flags:  programFlags{},
+			getter: fakeGetter{certificates: chain(good)},
+		},
+		{
+			name:   "ocsp_responder_good",
+			flags:  programFlags{ocspQuery: true},
+			getter: fakeGetter{certificates: chain(good)},
+		},
+		{
+			name:   "ocsp_responder_warning",
+			flags:  programFlags{ocspQuery: true, ocspWarn: "72:", ocspCrit: "24:"},
+			getter: fakeGetter{certificates: chain(good)},
+		},
+		{
+			name:   "ocsp_responder_revoked",
+			flags:  programFlags{ocspQuery: true},
+			getter: fakeGetter{certificates: chain(revoked)},
+		},
+		{
+			name:   "ocsp_responder_unknown",
+			flags:  programFlags{ocspQuery: true},
+			getter: fakeGetter{certificates: chain(unknown)},
+		},
+		{
+			name:   "ocsp_no_responder",
+			flags:  programFlags{ocspQuery: true},
+			getter: fakeGetter{certificates: chain(noResponder)},
+		},
+		{
+			name:  "ocsp_range_invalid",
+			flags: programFlags{ocspWarn: "72:24"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.flags.hostname = "example.org"
+			test.flags.port = 443
+			test.flags.warn = -1
+			test.flags.crit = -1
+			program := &checkProgram{programFlags: test.flags, roots: testRoots()}
+			p := plugin.New(Name)
+			if program.CheckFlags(p) {
+				program.getter = test.getter
+				program.Run(p)
+			}
+			checkGolden(t, test.name, p)
+		})
+	}
+}
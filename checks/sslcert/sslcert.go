@@ -0,0 +1,600 @@
+// Package sslcert implements a check of the certificate presented by a TLS
+// service, which verifies its names, its chain, its time to expiry and its
+// revocation status.
+package sslcert
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+//--------------------------------------------------------------------------------------------------------
+
+// Interface that can be implemented to fetch TLS certificates. The getter
+// returns the state of the TLS connection once the handshake is complete.
+type certGetter interface {
+	getCertificate(ctx context.Context, tlsConfig *tls.Config, address string) (*tls.ConnectionState, error)
+}
+
+// Apply the context's deadline, if there is one, to a connection.
+func setDeadline(ctx context.Context, conn net.Conn) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+}
+
+// Connect to a TCP server, using the context's deadline for both the
+// connection and subsequent operations.
+func dialContext(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	setDeadline(ctx, conn)
+	return conn, nil
+}
+
+// Full TLS certificate fetcher
+type fullTLSGetter struct{}
+
+func (f fullTLSGetter) getCertificate(ctx context.Context, tlsConfig *tls.Config, address string) (*tls.ConnectionState, error) {
+	dialer := tls.Dialer{Config: tlsConfig}
+	nc, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn := nc.(*tls.Conn)
+	defer conn.Close()
+	setDeadline(ctx, conn)
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	state := conn.ConnectionState()
+	return &state, nil
+}
+
+// SMTP+STARTTLS certificate getter
+type smtpGetter struct{}
+
+func (f smtpGetter) cmd(tcon *textproto.Conn, expectCode int, text string) (int, string, error) {
+	id, err := tcon.Cmd("%s", text)
+	if err != nil {
+		return 0, "", err
+	}
+	tcon.StartResponse(id)
+	defer tcon.EndResponse(id)
+	return tcon.ReadResponse(expectCode)
+}
+
+func (f smtpGetter) getCertificate(ctx context.Context, tlsConfig *tls.Config, address string) (*tls.ConnectionState, error) {
+	conn, err := dialContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	text := textproto.NewConn(conn)
+	defer text.Close()
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return nil, err
+	}
+	if _, _, err := f.cmd(text, 250, "HELO localhost"); err != nil {
+		return nil, err
+	}
+	if _, _, err := f.cmd(text, 220, "STARTTLS"); err != nil {
+		return nil, err
+	}
+	t := tls.Client(conn, tlsConfig)
+	if err := t.Handshake(); err != nil {
+		return nil, err
+	}
+	state := t.ConnectionState()
+	return &state, nil
+}
+
+// ManageSieve STARTTLS certificate getter
+type sieveGetter struct{}
+
+func (f sieveGetter) waitOK(conn net.Conn) error {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "OK") {
+			return nil
+		}
+		if strings.HasPrefix(line, "NO ") {
+			return errors.New(line[3:])
+		}
+		if strings.HasPrefix(line, "BYE ") {
+			return errors.New(line[4:])
+		}
+	}
+	return scanner.Err()
+}
+
+func (f sieveGetter) runCmd(conn net.Conn, cmd string) error {
+	if _, err := fmt.Fprintf(conn, "%s\r\n", cmd); err != nil {
+		return err
+	}
+	return f.waitOK(conn)
+}
+
+func (f sieveGetter) getCertificate(ctx context.Context, tlsConfig *tls.Config, address string) (*tls.ConnectionState, error) {
+	conn, err := dialContext(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := f.waitOK(conn); err != nil {
+		return nil, err
+	}
+	if err := f.runCmd(conn, "STARTTLS"); err != nil {
+		return nil, err
+	}
+	t := tls.Client(conn, tlsConfig)
+	if err := t.Handshake(); err != nil {
+		return nil, err
+	}
+	state := t.ConnectionState()
+	return &state, nil
+}
+
+// Supported StartTLS protocols
+var certGetters map[string]certGetter = map[string]certGetter{
+	"":      fullTLSGetter{},
+	"smtp":  &smtpGetter{},
+	"sieve": &sieveGetter{},
+}
+
+// Get a string that represents supported StartTLS protocols
+func listSupportedGetters() string {
+	sb := strings.Builder{}
+	for key := range certGetters {
+		if sb.Len() != 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(key)
+	}
+	return sb.String()
+}
+
+//--------------------------------------------------------------------------------------------------------
+
+// Command line flags that have been parsed.
+type programFlags struct {
+	hostname     string   // Main host name to connect to
+	port         int      // TCP port to connect to
+	warn         int      // Threshold for warning state (days)
+	crit         int      // Threshold for critical state (days)
+	warnRange    string   // Range for warning state
+	critRange    string   // Range for critical state
+	ignoreCnOnly bool     // Do not warn about SAN-less certificates
+	names        string   // Comma-separated list of extra names
+	extraNames   []string // Extra names the certificate should include
+	startTLS     string   // Protocol to use before requesting a switch to TLS.
+	caFile       string   // CA bundle used to verify the certificate chain
+	verify       bool     // Verify the certificate chain
+	ignoreRoot   bool     // Do not check the root's time to expiry
+	ocspQuery    bool     // Query the OCSP responder if there is no staple
+	ocspWarn     string   // Range of OCSP response validity for warning state
+	ocspCrit     string   // Range of OCSP response validity for critical state
+	crlCheck     bool     // Check the CRL from the distribution points
+	crlFile      string   // Local CRL file to check
+	crlWarn      string   // Range of CRL validity for warning state
+	crlCrit      string   // Range of CRL validity for critical state
+}
+
+// Program data including configuration and runtime data.
+type checkProgram struct {
+	programFlags                        // Flags from the command line
+	plugin         *plugin.Plugin       // Plugin output state
+	getter         certGetter           // Certificate getter
+	connState      *tls.ConnectionState // State of the TLS connection
+	certificate    *x509.Certificate    // X.509 certificate from the server
+	thresholds     plugin.Thresholds    // Warning and critical ranges
+	roots          *x509.CertPool       // Trusted roots; nil for the system pool
+	chain          []*x509.Certificate  // Verified certificate chain
+	ocspThresholds plugin.Thresholds    // OCSP response validity ranges
+	crlThresholds  plugin.Thresholds    // CRL validity ranges
+}
+
+// Declare the command line flags.
+func (program *checkProgram) DeclareFlags(flags *plugin.Flags) {
+	flags.StringVarP(&program.hostname, 'H', "hostname", "", "Host name to connect to.")
+	flags.IntVarP(&program.port, 'P', "port", -1, "Port to connect to.")
+	flags.IntVarP(&program.warn, 'W', "warning", -1,
+		"Validity threshold below which a warning state is issued, in days.")
+	flags.IntVarP(&program.crit, 'C', "critical", -1,
+		"Validity threshold below which a critical state is issued, in days.")
+	flags.StringVarP(&program.warnRange, 'w', "warning-range", "",
+		"Validity range outside of which a warning state is issued, in days.")
+	flags.StringVarP(&program.critRange, 'c', "critical-range", "",
+		"Validity range outside of which a critical state is issued, in days.")
+	flags.BoolVar(&program.ignoreCnOnly, "ignore-cn-only", false,
+		"Do not issue warnings regarding certificates that do not use SANs at all.")
+	flags.StringVarP(&program.names, 'a', "additional-names", "",
+		"A comma-separated list of names that the certificate should also provide.")
+	flags.StringVarP(&program.startTLS, 's', "start-tls", "",
+		fmt.Sprintf(
+			"Protocol to use before requesting a switch to TLS. "+
+				"Supported protocols: %s.",
+			listSupportedGetters()))
+	flags.BoolVar(&program.verify, "verify-chain", false,
+		"Verify the certificate chain presented by the server.")
+	flags.StringVar(&program.caFile, "ca", "",
+		"CA bundle used to verify the certificate chain instead of the system's trusted roots. "+
+			"Implies --verify-chain.")
+	flags.BoolVar(&program.ignoreRoot, "ignore-root-expiry", false,
+		"Do not check the time to expiry of the chain's root.")
+	flags.BoolVar(&program.ocspQuery, "ocsp", false,
+		"Query the certificate's OCSP responder if the server does not staple a response.")
+	flags.StringVar(&program.ocspWarn, "ocsp-warning", "",
+		"Range of validity of the OCSP response outside of which a warning state is issued, in hours.")
+	flags.StringVar(&program.ocspCrit, "ocsp-critical", "",
+		"Range of validity of the OCSP response outside of which a critical state is issued, in hours.")
+	flags.BoolVar(&program.crlCheck, "crl", false,
+		"Check the CRL from the certificate's distribution points.")
+	flags.StringVar(&program.crlFile, "crl-file", "",
+		"Check a local CRL file instead of the certificate's distribution points.")
+	flags.StringVar(&program.crlWarn, "crl-warning", "",
+		"Range of validity of the CRL outside of which a warning state is issued, in hours.")
+	flags.StringVar(&program.crlCrit, "crl-critical", "",
+		"Range of validity of the CRL outside of which a critical state is issued, in hours.")
+}
+
+// Check the values that were specified from the command line. Returns true
+// if the arguments made sense.
+func (program *checkProgram) CheckFlags(p *plugin.Plugin) bool {
+	program.plugin = p
+	if program.hostname == "" {
+		program.plugin.SetState(plugin.UNKNOWN, "no hostname specified")
+		return false
+	}
+	if program.port < 1 || program.port > 65535 {
+		program.plugin.SetState(plugin.UNKNOWN, "invalid or missing port number")
+		return false
+	}
+	if program.warn != -1 && program.crit != -1 && program.warn <= program.crit {
+		program.plugin.SetState(plugin.UNKNOWN, "nonsensical thresholds")
+		return false
+	}
+	var ok bool
+	program.thresholds.Warn, ok = getThreshold(program.plugin, "warning", program.warn, program.warnRange)
+	if !ok {
+		return false
+	}
+	program.thresholds.Crit, ok = getThreshold(program.plugin, "critical", program.crit, program.critRange)
+	if !ok {
+		return false
+	}
+	program.ocspThresholds.Warn, ok = getThreshold(program.plugin, "OCSP warning", -1, program.ocspWarn)
+	if !ok {
+		return false
+	}
+	program.ocspThresholds.Crit, ok = getThreshold(program.plugin, "OCSP critical", -1, program.ocspCrit)
+	if !ok {
+		return false
+	}
+	program.crlThresholds.Warn, ok = getThreshold(program.plugin, "CRL warning", -1, program.crlWarn)
+	if !ok {
+		return false
+	}
+	program.crlThresholds.Crit, ok = getThreshold(program.plugin, "CRL critical", -1, program.crlCrit)
+	if !ok {
+		return false
+	}
+	getter, found := certGetters[program.startTLS]
+	if !found {
+		errstr := fmt.Sprintf("unsupported StartTLS protocol %s", program.startTLS)
+		program.plugin.SetState(plugin.UNKNOWN, errstr)
+		return false
+	}
+	program.getter = getter
+	if program.caFile != "" {
+		roots, err := loadCABundle(program.caFile)
+		if err != nil {
+			program.plugin.SetState(plugin.UNKNOWN, err.Error())
+			return false
+		}
+		program.roots = roots
+		program.verify = true
+	}
+	program.hostname = strings.ToLower(program.hostname)
+	program.extraNames = splitNames(program.names)
+	return true
+}
+
+// Get the range for a threshold from either the legacy day count or the
+// range specified on the command line. Returns false, after updating the
+// plugin's state, if the values are invalid.
+func getThreshold(p *plugin.Plugin, name string, days int, spec string) (*perfdata.PerfDataRange, bool) {
+	if spec == "" {
+		if days <= 0 {
+			return nil, true
+		}
+		return perfdata.PDRMinMax("~", perfdata.FormatInt(int64(days))).Inside(), true
+	}
+	if days != -1 {
+		errstr := fmt.Sprintf("both %s threshold and %s range specified", name, name)
+		p.SetState(plugin.UNKNOWN, errstr)
+		return nil, false
+	}
+	r, err := perfdata.ParseRange(spec)
+	if err != nil {
+		p.SetState(plugin.UNKNOWN, err.Error())
+		return nil, false
+	}
+	return r, true
+}
+
+// Connect to the remote host and obtain the certificate. Returns an error
+// if connecting or performing the TLS handshake fail.
+func (program *checkProgram) getCertificate() error {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	}
+	connString := fmt.Sprintf("%s:%d", program.hostname, program.port)
+	if program.startTLS == "" {
+		program.plugin.Log(plugin.VERBOSE_CONFIG, "connecting to %s using TLS", connString)
+	} else {
+		program.plugin.Log(plugin.VERBOSE_CONFIG, "connecting to %s using %s+STARTTLS",
+			connString, program.startTLS)
+	}
+	state, err := program.getter.getCertificate(program.plugin.Context(), tlsConfig, connString)
+	if err != nil {
+		return err
+	}
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("no certificate received from server")
+	}
+	program.connState = state
+	program.certificate = state.PeerCertificates[0]
+	program.logConnectionState()
+	return nil
+}
+
+// Names of the TLS protocol versions.
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// Log information about the TLS connection and the certificates presented
+// by the server, depending on the plugin's verbosity.
+func (program *checkProgram) logConnectionState() {
+	program.plugin.Log(plugin.VERBOSE_INFO, "certificate subject: %s; issuer: %s",
+		program.certificate.Subject, program.certificate.Issuer)
+	state := program.connState
+	program.plugin.Log(plugin.VERBOSE_DEBUG, "handshake: version %s, cipher suite %s, server name '%s', protocol '%s'",
+		tlsVersions[state.Version], tls.CipherSuiteName(state.CipherSuite),
+		state.ServerName, state.NegotiatedProtocol)
+	for i, cert := range state.PeerCertificates {
+		program.plugin.Log(plugin.VERBOSE_DEBUG,
+			"chain[%d]: subject %s; issuer %s; serial %s; valid from %s to %s; DNS names %v",
+			i, cert.Subject, cert.Issuer, cert.SerialNumber,
+			cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339),
+			cert.DNSNames)
+	}
+}
+
+// Split a comma-separated list of names, converting them to lower case.
+func splitNames(names string) []string {
+	if names == "" {
+		return make([]string, 0)
+	}
+	return strings.Split(strings.ToLower(names), ",")
+}
+
+// Check that the CN of a certificate that doesn't contain a SAN actually
+// matches the requested host name, returning a status code and description.
+func checkSANlessCertificate(cert *x509.Certificate, hostname string, extraNames []string,
+	ignoreCnOnly bool) (plugin.Status, string) {
+	if !ignoreCnOnly || len(extraNames) != 0 {
+		return plugin.WARNING, "certificate doesn't have SAN domain names"
+	}
+	if strings.ToLower(cert.Subject.CommonName) != hostname {
+		return plugin.CRITICAL, "incorrect certificate CN"
+	}
+	return plugin.OK, "certificate CN matches host name"
+}
+
+// Checks whether a name is listed in the certificate's DNS names. If the name
+// cannot be found, a line that refers to the certificate using `what` will
+// be added to the plugin output and false will be returned.
+func checkHostName(p *plugin.Plugin, cert *x509.Certificate, name, what string) bool {
+	if hasDNSName(cert, name) {
+		return true
+	}
+	p.AddLine(fmt.Sprintf("missing DNS name %s in %s", name, what))
+	return false
+}
+
+// Check whether a lower-case name is listed in a certificate's DNS names.
+func hasDNSName(cert *x509.Certificate, name string) bool {
+	for _, n := range cert.DNSNames {
+		if strings.ToLower(n) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Ensure a certificate matches the host name, if it is set, and the
+// additional names, returning a status code and description. Certificates
+// that rely on their CN are handled according to `ignoreCnOnly`.
+func checkCertificateNames(p *plugin.Plugin, cert *x509.Certificate, hostname string,
+	extraNames []string, ignoreCnOnly bool, what string) (plugin.Status, string) {
+	if len(cert.DNSNames) == 0 {
+		return checkSANlessCertificate(cert, hostname, extraNames, ignoreCnOnly)
+	}
+	ok := hostname == "" || checkHostName(p, cert, hostname, what)
+	for _, name := range extraNames {
+		ok = checkHostName(p, cert, name, what) && ok
+	}
+	if !ok {
+		return plugin.CRITICAL, "names missing from SAN domain names"
+	}
+	return plugin.OK, "all names present in SAN domain names"
+}
+
+// Ensure the certificate matches the specified names, returning a status
+// code and description.
+func (program *checkProgram) checkNames() (plugin.Status, string) {
+	return checkCertificateNames(program.plugin, program.certificate, program.hostname,
+		program.extraNames, program.ignoreCnOnly, "certificate")
+}
+
+// Result of the evaluation of a certificate's time to expiry.
+type expiryResult struct {
+	status  plugin.Status // Status of the certificate
+	message string        // Description of the status
+	days    int           // Days left until the certificate expires
+}
+
+// Select the result of the certificate that is in the worst state or, among
+// certificates that are in the same state, the closest to expiry.
+func worstExpiry(results []expiryResult) (plugin.Status, string) {
+	if len(results) == 0 {
+		return plugin.OK, ""
+	}
+	worst := results[0]
+	for _, r := range results[1:] {
+		if r.status.Worse(worst.status) || (r.status == worst.status && r.days < worst.days) {
+			worst = r
+		}
+	}
+	return worst.status, worst.message
+}
+
+// Check a certificate's time to expiry agains the warning and critical
+// thresholds, returning a status code and description based on these
+// values, as well as the amount of days left. The time to expiry is also
+// added to the plugin's performance data using the specified label.
+func evaluateExpiry(p *plugin.Plugin, thresholds plugin.Thresholds, cert *x509.Certificate,
+	label, name string) expiryResult {
+	tlDays := daysLeft(cert.NotAfter)
+	pdat := perfdata.NewInt(label, perfdata.UOM_NONE, int64(tlDays))
+	state := thresholds.Evaluate(float64(tlDays), pdat)
+	p.AddPerfData(pdat)
+	if tlDays <= 0 {
+		return expiryResult{plugin.CRITICAL, name + " expired", tlDays}
+	}
+	var limitStr string
+	switch state {
+	case plugin.CRITICAL:
+		limitStr = fmt.Sprintf(" (critical threshold %s)", thresholds.Crit)
+	case plugin.WARNING:
+		limitStr = fmt.Sprintf(" (warning threshold %s)", thresholds.Warn)
+	}
+	statusString := fmt.Sprintf("%s will expire in %d days%s",
+		name, tlDays, limitStr)
+	return expiryResult{state, statusString, tlDays}
+}
+
+// Check the time to expiry of an element of the chain. The leaf's label is
+// "validity", while the other elements of the chain use their position as
+// a suffix.
+func (program *checkProgram) checkCertificateExpiry(cert *x509.Certificate, index int) expiryResult {
+	label, name := "validity", "certificate"
+	if index != 0 {
+		label = fmt.Sprintf("validity_%d", index)
+		name = fmt.Sprintf("chain certificate %s", cert.Subject)
+	}
+	return evaluateExpiry(program.plugin, program.thresholds, cert, label, name)
+}
+
+// Get the certificates whose time to expiry must be checked. The verified
+// chain is used if it is available, otherwise the certificates presented by
+// the server are used. Roots, i.e. self-signed certificates other than the
+// leaf, may be ignored.
+func (program *checkProgram) expiryChain() []*x509.Certificate {
+	certs := program.chain
+	if len(certs) == 0 {
+		certs = program.connState.PeerCertificates
+	}
+	result := make([]*x509.Certificate, 0, len(certs))
+	for i, cert := range certs {
+		if isIgnoredRoot(cert, i, program.ignoreRoot) {
+			continue
+		}
+		result = append(result, cert)
+	}
+	return result
+}
+
+// Check whether the expiry of a certificate must be ignored because it is
+// a root, i.e. a self-signed certificate that is not the first one of a
+// chain or bundle, and roots are being ignored.
+func isIgnoredRoot(cert *x509.Certificate, index int, ignoreRoot bool) bool {
+	return index != 0 && ignoreRoot && isSelfSigned(cert)
+}
+
+// Check the time to expiry of each certificate in the chain, returning the
+// status and description of the certificate that is in the worst state or,
+// among certificates that are in the same state, the closest to expiry.
+func (program *checkProgram) checkChainExpiry() (plugin.Status, string) {
+	var results []expiryResult
+	for i, cert := range program.expiryChain() {
+		results = append(results, program.checkCertificateExpiry(cert, i))
+	}
+	return worstExpiry(results)
+}
+
+// Compute the amount of days left before a certificate expires, rounding
+// up partial days.
+func daysLeft(notAfter time.Time) int {
+	timeLeft := notAfter.Sub(time.Now())
+	return int((timeLeft + 86399*time.Second) / (24 * time.Hour))
+}
+
+// Run the check: fetch the certificate, check its names, verify the chain
+// then check the time to expiry of the chain's elements and the certificate's
+// revocation status using OCSP and CRLs, and update the plugin's performance
+// data.
+func (program *checkProgram) Run(p *plugin.Plugin) {
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "thresholds: %s", program.thresholds)
+	err := program.getCertificate()
+	if err != nil {
+		program.plugin.SetState(plugin.UNKNOWN, err.Error())
+	} else {
+		program.plugin.AddResult(program.checkNames())
+		if program.verify {
+			program.plugin.AddResult(program.checkChain())
+		}
+		program.plugin.AddResult(program.checkChainExpiry())
+		if status, message, ok := program.checkOCSP(); ok {
+			program.plugin.AddResult(status, message)
+		}
+		if status, message, ok := program.checkCRL(); ok {
+			program.plugin.AddResult(status, message)
+		}
+	}
+}
+
+// Name of the plugin, as displayed in its output.
+const Name = "Certificate check"
+
+// Command is the name under which the check is registered.
+const Command = "check_ssl_certificate"
+
+// New creates an instance of the check.
+func New() plugin.Check {
+	return &checkProgram{}
+}
+
+func init() {
+	plugin.Register(Command, Name, New)
+}
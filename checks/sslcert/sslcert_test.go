@@ -0,0 +1,358 @@
+package sslcert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// Certificate getter that returns a fixed certificate chain or error.
+type fakeGetter struct {
+	certificates []*x509.Certificate
+	ocspResponse []byte
+	err          error
+}
+
+func (f fakeGetter) getCertificate(ctx context.Context, tlsConfig *tls.Config, address string) (*tls.ConnectionState, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &tls.ConnectionState{
+		PeerCertificates: f.certificates,
+		OCSPResponse:     f.ocspResponse,
+	}, nil
+}
+
+// A certificate and its private key, used to sign other certificates.
+type testIssuer struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// Serial number of the last test certificate.
+var testSerial int64
+
+// Create a certificate that expires in the specified amount of days. If the
+// issuer is nil, the certificate is self-signed.
+func issueCertificate(issuer *testIssuer, template *x509.Certificate, days int) *testIssuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	testSerial++
+	template.SerialNumber = big.NewInt(testSerial)
+	template.NotAfter = time.Now().Add(time.Duration(days)*24*time.Hour - time.Hour)
+	template.NotBefore = time.Now().Add(-3650 * 24 * time.Hour)
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.certificate, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return &testIssuer{certificate: cert, key: key}
+}
+
+// Create a CA certificate.
+func makeCA(issuer *testIssuer, cn string, days int) *testIssuer {
+	return issueCertificate(issuer, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, days)
+}
+
+// Test certification authorities. Only the root is trusted by default.
+var (
+	testRoot         = makeCA(nil, "Test Root CA", 3650)
+	testIntermediate = makeCA(testRoot, "Test Intermediate CA", 1000)
+	untrustedRoot    = makeCA(nil, "Untrusted Root CA", 3650)
+	untrustedCA      = makeCA(untrustedRoot, "Untrusted Intermediate CA", 1000)
+	shortLivedCA     = makeCA(testRoot, "Short-lived Intermediate CA", 8)
+)
+
+// Pool that contains the trusted test root.
+func testRoots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(testRoot.certificate)
+	return pool
+}
+
+// Create a certificate issued by the specified CA.
+func makeCertificate(issuer *testIssuer, cn string, days int, names ...string) *x509.Certificate {
+	return issueCertificate(issuer, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: names,
+	}, days).certificate
+}
+
+// Create a certificate issued by the test intermediate CA, followed by the
+// intermediate CA's certificate.
+func makeChain(cn string, days int, names ...string) []*x509.Certificate {
+	return []*x509.Certificate{
+		makeCertificate(testIntermediate, cn, days, names...),
+		testIntermediate.certificate,
+	}
+}
+
+// Compare a plugin's rendered result with the contents of a golden file.
+func checkGolden(t *testing.T, name string, p *plugin.Plugin) {
+	t.Helper()
+	compareGolden(t, name, p.Result().String()+"\n")
+}
+
+// Compare some text with the contents of a golden file.
+func compareGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output mismatch\n--- got ---\n%s--- want ---\n%s", got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name      string
+		flags     programFlags
+		getter    certGetter
+		verbosity int
+	}{
+		{
+			name:  "no_hostname",
+			flags: programFlags{port: 443, warn: -1, crit: -1},
+		},
+		{
+			name:  "bad_thresholds",
+			flags: programFlags{hostname: "example.org", port: 443, warn: 5, crit: 10},
+		},
+		{
+			name:   "connect_error",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1},
+			getter: fakeGetter{err: errors.New("connection refused")},
+		},
+		{
+			name:   "ok",
+			flags:  programFlags{hostname: "Example.org", port: 443, warn: 10, crit: 5},
+			getter: fakeGetter{certificates: makeChain("example.org", 30, "example.org")},
+		},
+		{
+			name:   "warning",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: 10, crit: 5},
+			getter: fakeGetter{certificates: makeChain("example.org", 8, "example.org")},
+		},
+		{
+			name:   "expired",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: 10, crit: 5},
+			getter: fakeGetter{certificates: makeChain("example.org", -2, "example.org")},
+		},
+		{
+			name:   "range_warning",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, warnRange: "40:", critRange: "20:"},
+			getter: fakeGetter{certificates: makeChain("example.org", 30, "example.org")},
+		},
+		{
+			name:   "range_critical",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, warnRange: "40:", critRange: "@20:35"},
+			getter: fakeGetter{certificates: makeChain("example.org", 30, "example.org")},
+		},
+		{
+			name:  "range_invalid",
+			flags: programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, warnRange: "40:20"},
+		},
+		{
+			name:  "range_conflict",
+			flags: programFlags{hostname: "example.org", port: 443, warn: 10, crit: -1, warnRange: "40:"},
+		},
+		{
+			name: "missing_names",
+			flags: programFlags{
+				hostname: "example.org", port: 443, warn: -1, crit: -1,
+				names: "www.example.org,mail.example.org",
+			},
+			getter: fakeGetter{certificates: makeChain("example.org", 30, "example.org", "www.example.org")},
+		},
+		{
+			name:      "verbose",
+			flags:     programFlags{hostname: "example.org", port: 443, warn: 10, crit: 5, startTLS: "smtp"},
+			getter:    fakeGetter{certificates: makeChain("example.org", 30, "example.org")},
+			verbosity: plugin.VERBOSE_CONFIG,
+		},
+		{
+			name:   "cn_only",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1},
+			getter: fakeGetter{certificates: makeChain("example.org", 30)},
+		},
+		{
+			name:  "chain_wrong_order",
+			flags: programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, verify: true},
+			getter: fakeGetter{certificates: []*x509.Certificate{
+				makeCertificate(testIntermediate, "example.org", 30, "example.org"),
+				testRoot.certificate,
+				testIntermediate.certificate,
+			}},
+		},
+		{
+			name:   "chain_incomplete",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, verify: true},
+			getter: fakeGetter{certificates: makeChain("example.org", 30, "example.org")[:1]},
+		},
+		{
+			name:  "chain_untrusted",
+			flags: programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, verify: true},
+			getter: fakeGetter{certificates: []*x509.Certificate{
+				makeCertificate(untrustedCA, "example.org", 30, "example.org"),
+				untrustedCA.certificate,
+				untrustedRoot.certificate,
+			}},
+		},
+		{
+			name:  "chain_self_signed",
+			flags: programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1, verify: true},
+			getter: fakeGetter{certificates: []*x509.Certificate{
+				makeCertificate(nil, "example.org", 30, "example.org"),
+			}},
+		},
+		{
+			name:   "chain_not_verified",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: -1, crit: -1},
+			getter: fakeGetter{certificates: makeChain("example.org", 30, "example.org")[:1]},
+		},
+		{
+			name:  "chain_expiry",
+			flags: programFlags{hostname: "example.org", port: 443, warn: 10, crit: 5, verify: true},
+			getter: fakeGetter{certificates: []*x509.Certificate{
+				makeCertificate(shortLivedCA, "example.org", 30, "example.org"),
+				shortLivedCA.certificate,
+			}},
+		},
+		{
+			name:   "chain_ignore_root",
+			flags:  programFlags{hostname: "example.org", port: 443, warn: 10, crit: 5, ignoreRoot: true, verify: true},
+			getter: fakeGetter{certificates: makeChain("example.org", 30, "example.org")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program := &checkProgram{programFlags: test.flags, roots: testRoots()}
+			p := plugin.New(Name)
+			p.SetVerbosity(test.verbosity)
+			if program.CheckFlags(p) {
+				if test.getter != nil {
+					program.getter = test.getter
+				}
+				program.Run(p)
+			}
+			checkGolden(t, test.name, p)
+		})
+	}
+}
+
+func TestGetterTimeout(t *testing.T) {
+	// Server that accepts connections but never sends anything.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	for name, getter := range certGetters {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		_, err := getter.getCertificate(ctx, &tls.Config{InsecureSkipVerify: true}, listener.Addr().String())
+		cancel()
+		if err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%q: getter returned after %v", name, elapsed)
+		}
+	}
+}
+
+func TestCABundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: untrustedRoot.certificate.Raw})
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	program := &checkProgram{programFlags: programFlags{
+		hostname: "example.org", port: 443, warn: -1, crit: -1, caFile: path,
+	}}
+	p := plugin.New(Name)
+	if !program.CheckFlags(p) {
+		t.Fatalf("unexpected flag error: %s", p.Result())
+	}
+	program.getter = fakeGetter{certificates: []*x509.Certificate{
+		makeCertificate(untrustedCA, "example.org", 30, "example.org"),
+		untrustedCA.certificate,
+	}}
+	program.Run(p)
+	if r := p.Result(); r.Status != plugin.OK {
+		t.Errorf("unexpected result %s", r)
+	}
+
+	program = &checkProgram{programFlags: programFlags{
+		hostname: "example.org", port: 443, warn: -1, crit: -1,
+		caFile: filepath.Join(t.TempDir(), "missing.pem"),
+	}}
+	p = plugin.New(Name)
+	if program.CheckFlags(p) {
+		t.Errorf("missing CA bundle accepted")
+	}
+}
+
+func TestWorstExpiry(t *testing.T) {
+	status, message := worstExpiry([]expiryResult{
+		{plugin.WARNING, "warning", 5},
+		{plugin.CRITICAL, "far critical", 20},
+		{plugin.CRITICAL, "close critical", 2},
+		{plugin.UNKNOWN, "unknown", 1},
+		{plugin.OK, "ok", 0},
+	})
+	if status != plugin.CRITICAL || message != "close critical" {
+		t.Errorf("got %v %q", status, message)
+	}
+	if status, message := worstExpiry(nil); status != plugin.OK || message != "" {
+		t.Errorf("got %v %q for no results", status, message)
+	}
+}
@@ -0,0 +1,218 @@
+// Package zoneserial implements a check that compares the serial of a DNS
+// zone on a server with the serial of the same zone on a reference server.
+package zoneserial
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+	"nocternity.net/go/monitoring/plugin"
+
+	"github.com/miekg/dns"
+)
+
+//-------------------------------------------------------------------------------------------------------
+
+type (
+	// A response to a DNS query. Includes the actual response, the RTT and the error, if any.
+	queryResponse struct {
+		data *dns.Msg
+		rtt  time.Duration
+		err  error
+	}
+
+	// A channel that can be used to send DNS query responses back to the caller.
+	responseChannel chan<- queryResponse
+
+	// A function that queries a DNS and sends the response using the channel.
+	queryFunc func(ctx context.Context, dnsq *dns.Msg, hostname string, port int, output responseChannel)
+)
+
+// Query a zone's SOA record through a given DNS and return the response using the channel.
+func queryZoneSOA(ctx context.Context, dnsq *dns.Msg, hostname string, port int, output responseChannel) {
+	dnsc := new(dns.Client)
+	address := net.JoinHostPort(hostname, fmt.Sprintf("%d", port))
+	in, rtt, err := dnsc.ExchangeContext(ctx, dnsq, address)
+	output <- queryResponse{
+		data: in,
+		rtt:  rtt,
+		err:  err,
+	}
+}
+
+//-------------------------------------------------------------------------------------------------------
+
+// Command line flags that have been parsed.
+type programFlags struct {
+	hostname   string // DNS to check - hostname
+	port       int    // DNS to check - port
+	zone       string // Zone name
+	rsHostname string // Reference DNS - hostname
+	rsPort     int    // Reference DNS - port
+	warnRange  string // Range of serial lag for warning state
+	critRange  string // Range of serial lag for critical state
+}
+
+// Program data including configuration and runtime data.
+type checkProgram struct {
+	programFlags                   // Flags from the command line
+	plugin       *plugin.Plugin    // Plugin output state
+	query        queryFunc         // Function used to query the servers
+	thresholds   plugin.Thresholds // Serial lag thresholds
+}
+
+// Declare the command line flags.
+func (program *checkProgram) DeclareFlags(flags *plugin.Flags) {
+	flags.StringVarP(&program.hostname, 'H', "hostname", "", "Hostname of the DNS to check.")
+	flags.IntVarP(&program.port, 'P', "port", 53, "Port number of the DNS to check.")
+	flags.StringVarP(&program.zone, 'z', "zone", "", "Zone name.")
+	flags.StringVarP(&program.rsHostname, 'r', "rs-hostname", "", "Hostname of the reference DNS.")
+	flags.IntVarP(&program.rsPort, 'p', "rs-port", 53, "Port number of the reference DNS.")
+	flags.StringVarP(&program.warnRange, 'w', "warning-range", "",
+		"Range of serial lag outside of which a warning state is issued.")
+	flags.StringVarP(&program.critRange, 'c', "critical-range", "",
+		"Range of serial lag outside of which a critical state is issued (0 if no range is set).")
+}
+
+// Check the values that were specified from the command line. Returns true if the arguments made sense.
+func (program *checkProgram) CheckFlags(p *plugin.Plugin) bool {
+	program.plugin = p
+	if program.hostname == "" {
+		program.plugin.SetState(plugin.UNKNOWN, "no DNS hostname specified")
+		return false
+	}
+	if program.port < 1 || program.port > 65535 {
+		program.plugin.SetState(plugin.UNKNOWN, "invalid DNS port number")
+		return false
+	}
+	if program.zone == "" {
+		program.plugin.SetState(plugin.UNKNOWN, "no DNS zone specified")
+		return false
+	}
+	if program.rsHostname == "" {
+		program.plugin.SetState(plugin.UNKNOWN, "no reference DNS hostname specified")
+		return false
+	}
+	if program.rsPort < 1 || program.rsPort > 65535 {
+		program.plugin.SetState(plugin.UNKNOWN, "invalid reference DNS port number")
+		return false
+	}
+	if program.warnRange == "" && program.critRange == "" {
+		program.critRange = "0"
+	}
+	thresholds, err := plugin.ParseThresholds(program.warnRange, program.critRange)
+	if err != nil {
+		program.plugin.SetState(plugin.UNKNOWN, err.Error())
+		return false
+	}
+	program.thresholds = thresholds
+	program.hostname = strings.ToLower(program.hostname)
+	program.zone = strings.ToLower(program.zone)
+	program.rsHostname = strings.ToLower(program.rsHostname)
+	return true
+}
+
+// Query both the server to check and the reference server for the zone's SOA record and return both
+// responses (checked server response and reference server response, respectively).
+func (program *checkProgram) queryServers() (queryResponse, queryResponse) {
+	dnsq := new(dns.Msg)
+	dnsq.SetQuestion(dns.Fqdn(program.zone), dns.TypeSOA)
+	checkOut := make(chan queryResponse)
+	refOut := make(chan queryResponse)
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "querying SOA of %s on checked server %s, port %d",
+		dnsq.Question[0].Name, program.hostname, program.port)
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "querying SOA of %s on reference server %s, port %d",
+		dnsq.Question[0].Name, program.rsHostname, program.rsPort)
+	ctx := program.plugin.Context()
+	go program.query(ctx, dnsq, program.hostname, program.port, checkOut)
+	go program.query(ctx, dnsq, program.rsHostname, program.rsPort, refOut)
+	var checkResponse, refResponse queryResponse
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-checkOut:
+			checkResponse = m
+		case m := <-refOut:
+			refResponse = m
+		}
+	}
+	return checkResponse, refResponse
+}
+
+// Add a server's RTT to the performance data.
+func (program *checkProgram) addRttPerf(name string, value time.Duration) {
+	program.plugin.AddPerfData(perfdata.NewDuration(name, value, 6))
+}
+
+// Log information about a server's response, depending on the plugin's verbosity.
+func (program *checkProgram) addResponseInfo(server string, response queryResponse) {
+	program.plugin.Log(plugin.VERBOSE_INFO, "%s server responded in %v", server, response.rtt)
+	program.plugin.Log(plugin.VERBOSE_DEBUG, "%s server response:\n%s", server, response.data)
+}
+
+// Add information about one of the servers' response to the plugin output. This includes
+// the error message if the query failed or the RTT performance data if it succeeded. It
+// then attempts to extract the serial from a server's response and returns it if
+// successful.
+func (program *checkProgram) getSerial(server string, response queryResponse) (ok bool, serial uint32) {
+	if response.err != nil {
+		program.plugin.AddLine("%s server error : %s", server, response.err)
+		return false, 0
+	}
+	program.addRttPerf(fmt.Sprintf("%s_rtt", server), response.rtt)
+	program.addResponseInfo(server, response)
+	if len(response.data.Answer) != 1 {
+		program.plugin.AddLine("%s server did not return exactly one record", server)
+		return false, 0
+	}
+	if soa, ok := response.data.Answer[0].(*dns.SOA); ok {
+		program.plugin.AddLine("serial on %s server: %d", server, soa.Serial)
+		return true, soa.Serial
+	}
+	t := reflect.TypeOf(response.data.Answer[0])
+	program.plugin.AddLine("%s server did not return SOA record; record type: %v", server, t)
+	return false, 0
+}
+
+// Run the monitoring check. This implies querying both servers, extracting the serial from
+// their responses, then checking the lag between the serials against the thresholds.
+func (program *checkProgram) Run(p *plugin.Plugin) {
+	program.plugin.Log(plugin.VERBOSE_CONFIG, "serial lag thresholds: %s", program.thresholds)
+	checkResponse, refResponse := program.queryServers()
+	cOk, cSerial := program.getSerial("checked", checkResponse)
+	rOk, rSerial := program.getSerial("reference", refResponse)
+	if !(cOk && rOk) {
+		program.plugin.SetState(plugin.UNKNOWN, "could not read serials")
+		return
+	}
+	// Serial number arithmetic (RFC 1982) handles wrapped serials.
+	lag := int32(rSerial - cSerial)
+	pdat := perfdata.NewInt("serial_lag", perfdata.UOM_NONE, int64(lag))
+	state := program.thresholds.Evaluate(float64(lag), pdat)
+	program.plugin.AddPerfData(pdat)
+	if lag == 0 {
+		program.plugin.SetState(state, "serials match")
+	} else {
+		program.plugin.SetState(state, "serials mismatch")
+		program.plugin.AddLine("serial lag: %d", lag)
+	}
+}
+
+// Name of the plugin, as displayed in its output.
+const Name = "DNS zone serial match check"
+
+// Command is the name under which the check is registered.
+const Command = "check_zone_serial"
+
+// New creates an instance of the check.
+func New() plugin.Check {
+	return &checkProgram{query: queryZoneSOA}
+}
+
+func init() {
+	plugin.Register(Command, Name, New)
+}
@@ -0,0 +1,204 @@
+package zoneserial
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nocternity.net/go/monitoring/plugin"
+
+	"github.com/miekg/dns"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// Create a query function that returns fixed responses for each host.
+func fakeQuery(responses map[string]queryResponse) queryFunc {
+	return func(ctx context.Context, dnsq *dns.Msg, hostname string, port int, output responseChannel) {
+		output <- responses[hostname]
+	}
+}
+
+// Create a response that contains the specified records.
+func makeResponse(rtt time.Duration, records ...dns.RR) queryResponse {
+	msg := new(dns.Msg)
+	msg.Answer = records
+	return queryResponse{data: msg, rtt: rtt}
+}
+
+// Create a SOA record with the specified serial.
+func makeSOA(serial uint32) dns.RR {
+	return &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Serial: serial,
+	}
+}
+
+// Compare a plugin's rendered result with the contents of a golden file.
+func checkGolden(t *testing.T, name string, p *plugin.Plugin) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	got := p.Result().String() + "\n"
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output mismatch\n--- got ---\n%s--- want ---\n%s", got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	flags := programFlags{
+		hostname:   "ns1.example.org",
+		port:       53,
+		zone:       "Example.org",
+		rsHostname: "ns0.example.org",
+		rsPort:     53,
+		critRange:  "0",
+	}
+	tolerant := flags
+	tolerant.warnRange = "0"
+	tolerant.critRange = "~:10"
+	warnOnly := flags
+	warnOnly.warnRange = "0"
+	warnOnly.critRange = ""
+	tests := []struct {
+		name      string
+		flags     programFlags
+		responses map[string]queryResponse
+		verbosity int
+	}{
+		{
+			name:  "no_zone",
+			flags: programFlags{hostname: "ns1.example.org", port: 53, rsHostname: "ns0.example.org", rsPort: 53},
+		},
+		{
+			name:  "serials_match",
+			flags: flags,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(2021010101)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2021010101)),
+			},
+		},
+		{
+			name:  "serials_mismatch",
+			flags: flags,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(2021010101)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2021010102)),
+			},
+		},
+		{
+			name:  "verbose",
+			flags: flags,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(2021010101)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2021010101)),
+			},
+			verbosity: plugin.VERBOSE_CONFIG,
+		},
+		{
+			name:  "lag_warning",
+			flags: tolerant,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(2021010101)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2021010103)),
+			},
+		},
+		{
+			name:  "lag_warning_only",
+			flags: warnOnly,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(2021010101)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2021010201)),
+			},
+		},
+		{
+			name:  "lag_wrapped",
+			flags: tolerant,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(4294967295)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2)),
+			},
+		},
+		{
+			name:  "lag_critical",
+			flags: tolerant,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(2021010101)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2021010201)),
+			},
+		},
+		{
+			name:  "invalid_range",
+			flags: programFlags{hostname: "ns1.example.org", port: 53, zone: "example.org", rsHostname: "ns0.example.org", rsPort: 53, critRange: "x"},
+		},
+		{
+			name:  "server_error",
+			flags: flags,
+			responses: map[string]queryResponse{
+				"ns1.example.org": {err: errors.New("i/o timeout")},
+				"ns0.example.org": makeResponse(3*time.Millisecond, makeSOA(2021010101)),
+			},
+		},
+		{
+			name:  "not_soa",
+			flags: flags,
+			responses: map[string]queryResponse{
+				"ns1.example.org": makeResponse(12*time.Millisecond, makeSOA(2021010101)),
+				"ns0.example.org": makeResponse(3*time.Millisecond, &dns.A{
+					Hdr: dns.RR_Header{Name: "example.org.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+				}),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program := &checkProgram{
+				programFlags: test.flags,
+				query:        fakeQuery(test.responses),
+			}
+			p := plugin.New(Name)
+			p.SetVerbosity(test.verbosity)
+			if program.CheckFlags(p) {
+				program.Run(p)
+			}
+			checkGolden(t, test.name, p)
+		})
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	// Server that never answers.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dnsq := new(dns.Msg)
+	dnsq.SetQuestion("example.org.", dns.TypeSOA)
+	output := make(chan queryResponse, 1)
+	start := time.Now()
+	queryZoneSOA(ctx, dnsq, "127.0.0.1", port, output)
+	if response := <-output; response.err == nil {
+		t.Errorf("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("query returned after %v", elapsed)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"nocternity.net/go/monitoring/checks/sslcert"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+func main() {
+	plugin.Main(sslcert.FileName, sslcert.NewFileCheck())
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"nocternity.net/go/monitoring/checks/nrpecheck"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+func main() {
+	plugin.Main(nrpecheck.Name, nrpecheck.New())
+}
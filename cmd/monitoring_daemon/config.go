@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Default interval between two runs of a check.
+const defaultInterval = 5 * time.Minute
+
+// Minimal interval between two runs of a check.
+const minInterval = time.Second
+
+// Definition of a check, as read from the configuration file.
+type checkDefinition struct {
+	Name      string   `json:"name"`
+	Command   string   `json:"command"`
+	Arguments []string `json:"arguments"`
+	Interval  string   `json:"interval"`
+
+	registration plugin.Registration
+	interval     time.Duration
+}
+
+// Configuration of the daemon.
+type daemonConfig struct {
+	Listen string             `json:"listen"`
+	Checks []*checkDefinition `json:"checks"`
+}
+
+// Validate a check's definition, looking up the check's command in the
+// registry and parsing its interval.
+func (def *checkDefinition) validate() error {
+	if def.Name == "" {
+		return fmt.Errorf("check has no name")
+	}
+	reg, ok := plugin.Lookup(def.Command)
+	if !ok {
+		return fmt.Errorf("check %s: unknown command '%s'", def.Name, def.Command)
+	}
+	def.registration = reg
+	def.interval = defaultInterval
+	if def.Interval != "" {
+		interval, err := time.ParseDuration(def.Interval)
+		if err != nil {
+			return fmt.Errorf("check %s: invalid interval '%s'", def.Name, def.Interval)
+		}
+		if interval < minInterval {
+			return fmt.Errorf("check %s: interval must be at least %v", def.Name, minInterval)
+		}
+		def.interval = interval
+	}
+	return nil
+}
+
+// Parse the daemon's configuration from a JSON document and validate it.
+func parseConfig(data []byte) (*daemonConfig, error) {
+	config := &daemonConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	names := make(map[string]bool)
+	for _, def := range config.Checks {
+		if err := def.validate(); err != nil {
+			return nil, err
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("duplicate check name '%s'", def.Name)
+		}
+		names[def.Name] = true
+	}
+	return config, nil
+}
+
+// Load the daemon's configuration from a file.
+func loadConfig(path string) (*daemonConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
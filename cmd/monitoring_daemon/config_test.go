@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig([]byte(`{
+		"listen": "127.0.0.1:9000",
+		"checks": [
+			{"name": "cert", "command": "check_ssl_certificate", "arguments": ["-H", "example.org"]},
+			{"name": "zone", "command": "check_zone_serial", "interval": "30s"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if config.Listen != "127.0.0.1:9000" || len(config.Checks) != 2 {
+		t.Fatalf("unexpected configuration %+v", config)
+	}
+	if config.Checks[0].interval != defaultInterval || config.Checks[1].interval != 30*time.Second {
+		t.Errorf("unexpected intervals %v %v", config.Checks[0].interval, config.Checks[1].interval)
+	}
+	if config.Checks[0].registration.Name != "Certificate check" {
+		t.Errorf("unexpected registration %+v", config.Checks[0].registration)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"checks": [`,
+		`{"checks": [{"command": "check_zone_serial"}]}`,
+		`{"checks": [{"name": "x", "command": "check_missing"}]}`,
+		`{"checks": [{"name": "x", "command": "check_zone_serial", "interval": "soon"}]}`,
+		`{"checks": [{"name": "x", "command": "check_zone_serial", "interval": "10ms"}]}`,
+		`{"checks": [{"name": "x", "command": "check_zone_serial"}, {"name": "x", "command": "check_ssl_certificate"}]}`,
+	} {
+		if _, err := parseConfig([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// JSON representation of a check's state.
+type checkStatus struct {
+	Name      string         `json:"name"`
+	Command   string         `json:"command"`
+	Arguments []string       `json:"arguments"`
+	Interval  float64        `json:"interval"`
+	LastRun   *time.Time     `json:"last_run"`
+	Duration  *float64       `json:"duration"`
+	Result    *plugin.Result `json:"result"`
+}
+
+// Convert a check's snapshot to its JSON representation. The time of the
+// last run and its duration are null if the check has not run yet.
+func (cs checkSnapshot) status() checkStatus {
+	status := checkStatus{
+		Name:      cs.def.Name,
+		Command:   cs.def.Command,
+		Arguments: cs.def.Arguments,
+		Interval:  cs.def.interval.Seconds(),
+		Result:    cs.result,
+	}
+	if status.Arguments == nil {
+		status.Arguments = []string{}
+	}
+	if cs.result != nil {
+		lastRun := cs.lastRun
+		duration := cs.duration.Seconds()
+		status.LastRun = &lastRun
+		status.Duration = &duration
+	}
+	return status
+}
+
+// Write a JSON document as an HTTP response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Create the HTTP handler that serves the checks' results and metrics.
+func (s *scheduler) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/checks", s.serveChecks)
+	mux.HandleFunc("/checks/", s.serveCheck)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	return mux
+}
+
+// Serve the list of all checks and their latest results.
+func (s *scheduler) serveChecks(w http.ResponseWriter, r *http.Request) {
+	snapshots := s.snapshots()
+	statuses := make([]checkStatus, len(snapshots))
+	for i, cs := range snapshots {
+		statuses[i] = cs.status()
+	}
+	writeJSON(w, statuses)
+}
+
+// Serve a single check's latest result.
+func (s *scheduler) serveCheck(w http.ResponseWriter, r *http.Request) {
+	sc, ok := s.index[strings.TrimPrefix(r.URL.Path, "/checks/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, sc.snapshot().status())
+}
+
+// Serve the checks' statuses and performance data using the OpenMetrics
+// text format. The performance data is exposed in the same way as by the
+// plugins' OpenMetrics export, with the checks' names and commands as
+// labels. Checks that have not run yet are omitted.
+func (s *scheduler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	var snapshots []checkSnapshot
+	for _, cs := range s.snapshots() {
+		if cs.result != nil {
+			snapshots = append(snapshots, cs)
+		}
+	}
+	e := perfdata.NewOpenMetricsExposition()
+	for _, cs := range snapshots {
+		labels := cs.labels()
+		e.AddGauge("monitoring_check_status", "",
+			"Status of the check (0: OK, 1: WARNING, 2: CRITICAL, 3: UNKNOWN).",
+			labels, float64(cs.result.Status))
+		e.AddGauge("monitoring_check_duration_seconds", "seconds",
+			"Duration of the check's latest run.", labels, cs.duration.Seconds())
+		e.AddGauge("monitoring_check_last_run_timestamp_seconds", "seconds",
+			"Time at which the check's latest run started.", labels,
+			float64(cs.lastRun.UnixNano())/1e9)
+	}
+	for _, cs := range snapshots {
+		e.AddPerfData(cs.labels(), time.Time{}, cs.result.PerfData)
+	}
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	e.Write(w)
+}
+
+// Get the OpenMetrics labels that identify a check.
+func (cs checkSnapshot) labels() []perfdata.OpenMetricsLabel {
+	return []perfdata.OpenMetricsLabel{
+		{Name: "check", Value: cs.def.Name},
+		{Name: "command", Value: cs.def.Command},
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"nocternity.net/go/monitoring/perfdata"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Run a check by returning a fixed result that depends on its arguments.
+func fakeRun(reg plugin.Registration, args []string) *plugin.Result {
+	r := &plugin.Result{Name: reg.Name, Status: plugin.OK, Message: strings.Join(args, " ")}
+	if len(args) == 0 {
+		r.Status = plugin.CRITICAL
+		r.Message = "no arguments"
+		return r
+	}
+	r.PerfData = []*perfdata.PerfData{
+		perfdata.New("rtt", perfdata.UOM_MILLISECONDS, "12"),
+		perfdata.New("missing", perfdata.UOM_NONE, ""),
+	}
+	return r
+}
+
+// Start a scheduler with two checks, wait for both to run once, and return
+// a test HTTP server for its API.
+func startTestDaemon(t *testing.T) (*scheduler, *httptest.Server, context.CancelFunc) {
+	config, err := parseConfig([]byte(`{"checks": [
+		{"name": "zone \"a\"", "command": "check_zone_serial", "arguments": ["-z", "example.org"]},
+		{"name": "cert", "command": "check_ssl_certificate", "interval": "1h"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan bool, 2)
+	s := newScheduler(config, func(reg plugin.Registration, args []string) *plugin.Result {
+		defer func() { ran <- true }()
+		return fakeRun(reg, args)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	s.start(ctx)
+	<-ran
+	<-ran
+	return s, httptest.NewServer(s.handler()), cancel
+}
+
+// Fetch a document from the test server.
+func get(t *testing.T, server *httptest.Server, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestChecksAPI(t *testing.T) {
+	s, server, cancel := startTestDaemon(t)
+	defer s.wait()
+	defer cancel()
+	defer server.Close()
+
+	code, body := get(t, server, "/checks")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	var statuses []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0]["name"] != `zone "a"` || statuses[1]["interval"] != 3600.0 {
+		t.Errorf("unexpected checks %s", body)
+	}
+
+	code, body = get(t, server, "/checks/cert")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	var status struct {
+		Result struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"result"`
+		LastRun *string `json:"last_run"`
+	}
+	if err := json.Unmarshal([]byte(body), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Result.Status != "ERROR" || status.Result.Message != "no arguments" || status.LastRun == nil {
+		t.Errorf("unexpected check status %s", body)
+	}
+
+	if code, _ = get(t, server, "/checks/missing"); code != http.StatusNotFound {
+		t.Errorf("unexpected status %d for a missing check", code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s, server, cancel := startTestDaemon(t)
+	defer s.wait()
+	defer cancel()
+	defer server.Close()
+
+	code, body := get(t, server, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	zone := `check="zone \"a\"",command="check_zone_serial"`
+	cert := `check="cert",command="check_ssl_certificate"`
+	for _, want := range []string{
+		"# TYPE monitoring_check_status gauge\n",
+		"monitoring_check_status{" + zone + "} 0\n",
+		"monitoring_check_status{" + cert + "} 2\n",
+		"# TYPE rtt_seconds gauge\n",
+		"rtt_seconds{" + zone + "} 0.012\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "missing") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("metrics contain unknown value:\n%s", body)
+	}
+	if !regexp.MustCompile(`monitoring_check_last_run_timestamp_seconds\{` + regexp.QuoteMeta(cert) +
+		`\} \d+(\.\d+)?\n`).MatchString(body) {
+		t.Errorf("metrics do not contain last run time:\n%s", body)
+	}
+}
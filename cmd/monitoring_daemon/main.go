@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "nocternity.net/go/monitoring/checks/nrpecheck"
+	_ "nocternity.net/go/monitoring/checks/sslcert"
+	_ "nocternity.net/go/monitoring/checks/zoneserial"
+	"nocternity.net/go/monitoring/plugin"
+
+	"github.com/karrick/golf"
+)
+
+// Delay allowed for pending HTTP requests when the daemon stops.
+const shutdownDelay = 5 * time.Second
+
+func main() {
+	var (
+		configPath string
+		listen     string
+		help       bool
+		version    bool
+	)
+	golf.StringVarP(&configPath, 'c', "config", "", "Path to the configuration file.")
+	golf.StringVarP(&listen, 'l', "listen", "",
+		"Address on which the HTTP server listens. Overrides the configuration file.")
+	golf.BoolVarP(&help, 'h', "help", false, "Display usage information.")
+	golf.BoolVarP(&version, 'V', "version", false, "Display version information.")
+	golf.Parse()
+	if help {
+		golf.Usage()
+		os.Exit(0)
+	}
+	if version {
+		fmt.Printf("Monitoring daemon %s\n", plugin.Version)
+		os.Exit(0)
+	}
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "no configuration file specified")
+		os.Exit(1)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if listen != "" {
+		config.Listen = listen
+	}
+	if config.Listen == "" {
+		config.Listen = ":8080"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newScheduler(config, runRegistered)
+	server := &http.Server{
+		Addr:    config.Listen,
+		Handler: s.handler(),
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+		sctx, scancel := context.WithTimeout(context.Background(), shutdownDelay)
+		defer scancel()
+		server.Shutdown(sctx)
+	}()
+
+	s.start(ctx)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		fmt.Fprintf(os.Stderr, "HTTP server failed: %v\n", err)
+		cancel()
+		s.wait()
+		os.Exit(1)
+	}
+	s.wait()
+}
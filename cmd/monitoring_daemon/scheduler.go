@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// A function that runs a check in-process and returns its result.
+type runFunc func(reg plugin.Registration, args []string) *plugin.Result
+
+// Run a registered check using the plugin package.
+func runRegistered(reg plugin.Registration, args []string) *plugin.Result {
+	return plugin.RunCheck(reg.Name, reg.New(), args)
+}
+
+// The state of a scheduled check, including its latest result.
+type scheduledCheck struct {
+	def      *checkDefinition
+	lock     sync.Mutex
+	result   *plugin.Result
+	lastRun  time.Time
+	duration time.Duration
+}
+
+// Snapshot of a scheduled check's state.
+type checkSnapshot struct {
+	def      *checkDefinition
+	result   *plugin.Result
+	lastRun  time.Time
+	duration time.Duration
+}
+
+// Get a copy of the check's current state.
+func (sc *scheduledCheck) snapshot() checkSnapshot {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	return checkSnapshot{
+		def:      sc.def,
+		result:   sc.result,
+		lastRun:  sc.lastRun,
+		duration: sc.duration,
+	}
+}
+
+// Run the check once and store its result.
+func (sc *scheduledCheck) runOnce(run runFunc) {
+	start := time.Now()
+	result := run(sc.def.registration, sc.def.Arguments)
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	sc.result = result
+	sc.lastRun = start
+	sc.duration = time.Since(start)
+}
+
+// Scheduler runs the configured checks periodically.
+type scheduler struct {
+	checks []*scheduledCheck
+	index  map[string]*scheduledCheck
+	run    runFunc
+	wg     sync.WaitGroup
+}
+
+// Create a scheduler for the checks from the configuration.
+func newScheduler(config *daemonConfig, run runFunc) *scheduler {
+	s := &scheduler{
+		index: make(map[string]*scheduledCheck),
+		run:   run,
+	}
+	for _, def := range config.Checks {
+		sc := &scheduledCheck{def: def}
+		s.checks = append(s.checks, sc)
+		s.index[def.Name] = sc
+	}
+	return s
+}
+
+// Start running the checks. Each check is run immediately, then at its
+// configured interval, until the context is cancelled.
+func (s *scheduler) start(ctx context.Context) {
+	for _, sc := range s.checks {
+		s.wg.Add(1)
+		go func(sc *scheduledCheck) {
+			defer s.wg.Done()
+			ticker := time.NewTicker(sc.def.interval)
+			defer ticker.Stop()
+			for {
+				sc.runOnce(s.run)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(sc)
+	}
+}
+
+// Wait for all checks to stop once the scheduler's context is cancelled.
+func (s *scheduler) wait() {
+	s.wg.Wait()
+}
+
+// Get snapshots of all checks, in the configuration's order.
+func (s *scheduler) snapshots() []checkSnapshot {
+	snapshots := make([]checkSnapshot, len(s.checks))
+	for i, sc := range s.checks {
+		snapshots[i] = sc.snapshot()
+	}
+	return snapshots
+}
@@ -0,0 +1,73 @@
+// The monitoring_plugins command includes all plugins in a single binary.
+// The plugin to run is selected using the name of the binary, so that
+// symbolic links named after the plugins may be used, or using the first
+// argument.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "nocternity.net/go/monitoring/checks/nrpecheck"
+	_ "nocternity.net/go/monitoring/checks/sslcert"
+	_ "nocternity.net/go/monitoring/checks/zoneserial"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Find the check to run from the command line. If the program's name is
+// that of a registered check, it is used directly; otherwise the first
+// argument selects the check. The returned arguments, which begin with the
+// name of the check, replace the program's arguments.
+func selectCheck(args []string) (plugin.Registration, []string, bool) {
+	if len(args) == 0 {
+		return plugin.Registration{}, nil, false
+	}
+	command := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+	if reg, ok := plugin.Lookup(command); ok {
+		return reg, args, true
+	}
+	if len(args) > 1 {
+		if reg, ok := plugin.Lookup(args[1]); ok {
+			return reg, args[1:], true
+		}
+	}
+	return plugin.Registration{}, nil, false
+}
+
+// Print the program's usage, including the list of available checks.
+func usage(w io.Writer, program string) {
+	fmt.Fprintf(w, "Usage: %s <check> [arguments...]\n", program)
+	fmt.Fprintf(w, "   or: <check> [arguments...] (through a link named after the check)\n\n")
+	fmt.Fprintf(w, "Available checks:\n")
+	for _, command := range plugin.Commands() {
+		reg, _ := plugin.Lookup(command)
+		fmt.Fprintf(w, "  %-24s %s\n", command, reg.Name)
+	}
+}
+
+func main() {
+	reg, args, ok := selectCheck(os.Args)
+	if !ok {
+		program := filepath.Base(os.Args[0])
+		if len(os.Args) == 2 {
+			switch os.Args[1] {
+			case "-h", "--help", "help":
+				usage(os.Stdout, program)
+				os.Exit(0)
+			case "-V", "--version", "version":
+				fmt.Printf("Monitoring plugins %s\n", plugin.Version)
+				os.Exit(0)
+			}
+		}
+		if len(os.Args) > 1 {
+			fmt.Fprintf(os.Stderr, "unknown check '%s'\n\n", os.Args[1])
+		}
+		usage(os.Stderr, program)
+		os.Exit(int(plugin.UNKNOWN))
+	}
+	os.Args = args
+	plugin.Main(reg.Name, reg.New())
+}
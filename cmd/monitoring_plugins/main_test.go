@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectCheck(t *testing.T) {
+	tests := []struct {
+		args    []string
+		ok      bool
+		command string
+		rest    []string
+	}{
+		{
+			args:    []string{"/usr/lib/nagios/plugins/check_zone_serial", "-z", "example.org"},
+			ok:      true,
+			command: "check_zone_serial",
+			rest:    []string{"/usr/lib/nagios/plugins/check_zone_serial", "-z", "example.org"},
+		},
+		{
+			args:    []string{"plugins/check_nrpe.exe", "-H", "host"},
+			ok:      true,
+			command: "check_nrpe",
+			rest:    []string{"plugins/check_nrpe.exe", "-H", "host"},
+		},
+		{
+			args:    []string{"/usr/bin/monitoring_plugins", "check_ssl_certificate", "-H", "example.org"},
+			ok:      true,
+			command: "check_ssl_certificate",
+			rest:    []string{"check_ssl_certificate", "-H", "example.org"},
+		},
+		{args: []string{"/usr/bin/monitoring_plugins", "check_missing"}},
+		{args: []string{"/usr/bin/monitoring_plugins"}},
+		{args: []string{}},
+	}
+	for _, test := range tests {
+		reg, rest, ok := selectCheck(test.args)
+		if ok != test.ok {
+			t.Errorf("%q: expected %v, got %v", test.args, test.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if reg.Command != test.command || !reflect.DeepEqual(rest, test.rest) {
+			t.Errorf("%q: unexpected result %s %q", test.args, reg.Command, rest)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var buf bytes.Buffer
+	usage(&buf, "monitoring_plugins")
+	for _, command := range []string{"check_nrpe", "check_ssl_certificate", "check_zone_serial"} {
+		if !strings.Contains(buf.String(), command) {
+			t.Errorf("usage does not list %s:\n%s", command, buf.String())
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"nocternity.net/go/monitoring/nrpe"
+	"nocternity.net/go/monitoring/plugin"
+)
+
+// Default timeout for the reception of queries and the sending of responses.
+const defaultTimeout = 10 * time.Second
+
+// Definition of a command, as read from the configuration file. Arguments
+// may include $ARGn$ macros, which are replaced with the query's arguments;
+// macros may only be used in the values of flags. Query arguments that
+// begin with a dash are rejected unless AllowDash is set.
+type commandDefinition struct {
+	Command   string   `json:"command"`
+	Arguments []string `json:"arguments"`
+	AllowDash bool     `json:"allow_dash"`
+
+	registration plugin.Registration
+}
+
+// TLS configuration of the server.
+type tlsDefinition struct {
+	Cert     string `json:"cert"`
+	Key      string `json:"key"`
+	ClientCA string `json:"client_ca"`
+}
+
+// Configuration of the server.
+type serverConfig struct {
+	Listen         string                        `json:"listen"`
+	TLS            *tlsDefinition                `json:"tls"`
+	AllowedHosts   []string                      `json:"allowed_hosts"`
+	AllowArguments bool                          `json:"allow_arguments"`
+	Timeout        string                        `json:"timeout"`
+	Commands       map[string]*commandDefinition `json:"commands"`
+
+	allowedHosts []*net.IPNet
+	timeout      time.Duration
+}
+
+// Parse the server's configuration from a JSON document and validate it.
+func parseConfig(data []byte) (*serverConfig, error) {
+	config := &serverConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	for _, spec := range config.AllowedHosts {
+		network, err := nrpe.ParseAllowedHost(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed host: %w", err)
+		}
+		config.allowedHosts = append(config.allowedHosts, network)
+	}
+	config.timeout = defaultTimeout
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout '%s'", config.Timeout)
+		}
+		config.timeout = timeout
+	}
+	if config.TLS != nil && (config.TLS.Cert == "" || config.TLS.Key == "") {
+		return nil, fmt.Errorf("TLS requires both a certificate and a key")
+	}
+	for name, def := range config.Commands {
+		reg, ok := plugin.Lookup(def.Command)
+		if !ok {
+			return nil, fmt.Errorf("command %s: unknown check '%s'", name, def.Command)
+		}
+		if err := checkMacros(reg.New(), def.Arguments); err != nil {
+			return nil, fmt.Errorf("command %s: %w", name, err)
+		}
+		def.registration = reg
+	}
+	return config, nil
+}
+
+// Load the server's configuration from a file.
+func loadConfig(path string) (*serverConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+// Build the server's TLS configuration. If a client CA bundle is configured,
+// clients must present a certificate signed by one of its authorities.
+func (def *tlsDefinition) config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(def.Cert, def.Key)
+	if err != nil {
+		return nil, fmt.Errorf("could not load certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if def.ClientCA != "" {
+		data, err := ioutil.ReadFile(def.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", def.ClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Regular expression that matches argument macros.
+var argMacro = regexp.MustCompile(`\$ARG([0-9]+)\$`)
+
+// Ensure that the $ARGn$ macros in a command's arguments are only used in
+// the values of the check's flags, so that queries cannot add flags to the
+// command.
+func checkMacros(check plugin.Check, templates []string) error {
+	offsets, err := plugin.FlagValueOffsets(check, templates)
+	if err != nil {
+		return err
+	}
+	for i, template := range templates {
+		for _, loc := range argMacro.FindAllStringIndex(template, -1) {
+			if offsets[i] == -1 || loc[0] < offsets[i] {
+				return fmt.Errorf("argument '%s': macros may only be used in flag values", template)
+			}
+		}
+	}
+	return nil
+}
+
+// Expand the $ARGn$ macros in a command's arguments. Macros that refer to
+// missing arguments are replaced with empty strings.
+func expandArguments(templates []string, args []string) []string {
+	result := make([]string, len(templates))
+	for i, template := range templates {
+		result[i] = argMacro.ReplaceAllStringFunc(template, func(macro string) string {
+			n, _ := strconv.Atoi(argMacro.FindStringSubmatch(macro)[1])
+			if n < 1 || n > len(args) {
+				return ""
+			}
+			return args[n-1]
+		})
+	}
+	return result
+}
+
+// Generate the NRPE handler that runs the configured commands in-process.
+func (config *serverConfig) handler() nrpe.Handler {
+	return func(command string, args []string) (int, string) {
+		def, ok := config.Commands[command]
+		if !ok {
+			return int(plugin.UNKNOWN), fmt.Sprintf("NRPE: Command '%s' not defined", command)
+		}
+		if !def.AllowDash {
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "-") {
+					return int(plugin.UNKNOWN), fmt.Sprintf(
+						"NRPE: Arguments of command '%s' may not begin with '-'", command)
+				}
+			}
+		}
+		reg := def.registration
+		r := plugin.RunCheck(reg.Name, reg.New(), expandArguments(def.Arguments, args))
+		return int(r.Status), r.String()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"nocternity.net/go/monitoring/plugin"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := parseConfig([]byte(`{
+		"listen": "127.0.0.1:5666",
+		"allowed_hosts": ["127.0.0.1", "10.0.0.0/8"],
+		"allow_arguments": true,
+		"timeout": "30s",
+		"commands": {
+			"check_cert": {"command": "check_ssl_certificate", "arguments": ["-H", "$ARG1$"]},
+			"check_port": {"command": "check_ssl_certificate", "arguments": ["-H$ARG1$", "--port=$ARG2$"]}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if config.Listen != "127.0.0.1:5666" || !config.AllowArguments || config.timeout != 30*time.Second {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+	if len(config.allowedHosts) != 2 || config.allowedHosts[1].String() != "10.0.0.0/8" {
+		t.Errorf("unexpected allowed hosts %v", config.allowedHosts)
+	}
+	if config.Commands["check_cert"].registration.Name != "Certificate check" {
+		t.Errorf("unexpected registration %+v", config.Commands["check_cert"].registration)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"commands": {`,
+		`{"allowed_hosts": ["somewhere"]}`,
+		`{"timeout": "soon"}`,
+		`{"tls": {"cert": "server.crt"}}`,
+		`{"commands": {"x": {"command": "check_missing"}}}`,
+		`{"commands": {"x": {"command": "check_nrpe", "arguments": ["-H", "host", "$ARG1$"]}}}`,
+		`{"commands": {"x": {"command": "check_nrpe", "arguments": ["-H", "host", "--$ARG1$=x"]}}}`,
+		`{"commands": {"x": {"command": "check_nrpe", "arguments": ["-H", "host", "-$ARG1$"]}}}`,
+	} {
+		if _, err := parseConfig([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestExpandArguments(t *testing.T) {
+	result := expandArguments(
+		[]string{"-H", "$ARG1$", "--port=$ARG2$", "$ARG3$", "$ARG0$", "literal"},
+		[]string{"example.org", "443"})
+	expected := []string{"-H", "example.org", "--port=443", "", "", "literal"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	config, err := parseConfig([]byte(`{
+		"commands": {"check_remote": {"command": "check_nrpe", "arguments": ["-H", "$ARG1$"]}}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	handler := config.handler()
+
+	code, output := handler("check_missing", nil)
+	if code != int(plugin.UNKNOWN) || !strings.Contains(output, "not defined") {
+		t.Errorf("unexpected result %d %q", code, output)
+	}
+	code, output = handler("check_remote", nil)
+	if code != int(plugin.UNKNOWN) || output != "NRPE check UNKNOWN: no hostname specified" {
+		t.Errorf("unexpected result %d %q", code, output)
+	}
+}
+
+func TestHandlerDashArguments(t *testing.T) {
+	template := `{"command": "check_ssl_certificate", ` +
+		`"arguments": ["-H", "$ARG1$", "-P", "443", "-a", "$ARG2$", "-s", "$ARG3$"]`
+	config, err := parseConfig([]byte(`{"commands": {` +
+		`"check_cert": ` + template + `},` +
+		`"check_dash": ` + template + `, "allow_dash": true}` +
+		`}}`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	handler := config.handler()
+	args := []string{"127.0.0.1", "-v", "--ca=/etc/hostname"}
+
+	code, output := handler("check_cert", args)
+	if code != int(plugin.UNKNOWN) ||
+		output != "NRPE: Arguments of command 'check_cert' may not begin with '-'" {
+		t.Errorf("unexpected result %d %q", code, output)
+	}
+	// When allowed, the arguments are only used as the flags' values.
+	code, output = handler("check_dash", args)
+	if code != int(plugin.UNKNOWN) ||
+		output != "Certificate check UNKNOWN: unsupported StartTLS protocol --ca=/etc/hostname" {
+		t.Errorf("unexpected result %d %q", code, output)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "nocternity.net/go/monitoring/checks/nrpecheck"
+	_ "nocternity.net/go/monitoring/checks/sslcert"
+	_ "nocternity.net/go/monitoring/checks/zoneserial"
+	"nocternity.net/go/monitoring/nrpe"
+	"nocternity.net/go/monitoring/plugin"
+
+	"github.com/karrick/golf"
+)
+
+func main() {
+	var (
+		configPath string
+		listen     string
+		help       bool
+		version    bool
+	)
+	golf.StringVarP(&configPath, 'c', "config", "", "Path to the configuration file.")
+	golf.StringVarP(&listen, 'l', "listen", "",
+		"Address on which the server listens. Overrides the configuration file.")
+	golf.BoolVarP(&help, 'h', "help", false, "Display usage information.")
+	golf.BoolVarP(&version, 'V', "version", false, "Display version information.")
+	golf.Parse()
+	if help {
+		golf.Usage()
+		os.Exit(0)
+	}
+	if version {
+		fmt.Printf("NRPE server %s\n", plugin.Version)
+		os.Exit(0)
+	}
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "no configuration file specified")
+		os.Exit(1)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if listen != "" {
+		config.Listen = listen
+	}
+	if config.Listen == "" {
+		config.Listen = fmt.Sprintf(":%d", nrpe.DefaultPort)
+	}
+
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not listen: %v\n", err)
+		os.Exit(1)
+	}
+	if config.TLS != nil {
+		tlsConfig, err := config.TLS.config()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not configure TLS: %v\n", err)
+			os.Exit(1)
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	server := &nrpe.Server{
+		Handler:        config.handler(),
+		AllowedHosts:   config.allowedHosts,
+		AllowArguments: config.AllowArguments,
+		Version:        plugin.Version,
+		Timeout:        config.timeout,
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+	server.Serve(listener)
+}
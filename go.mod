@@ -5,4 +5,6 @@ go 1.15
 require (
 	github.com/karrick/golf v1.4.0
 	github.com/miekg/dns v1.1.40
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
+	golang.org/x/sys v0.0.0-20190924154521-2837fb4f24fe
 )
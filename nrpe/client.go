@@ -0,0 +1,86 @@
+package nrpe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Client sends queries to a NRPE server.
+type Client struct {
+	// Address of the server, including its port.
+	Address string
+	// TLS configuration; TLS is not used if it is nil. The server's name is
+	// taken from the address if it is not set.
+	TLSConfig *tls.Config
+	// Version of the packets used for queries.
+	Version int16
+}
+
+// Response is a NRPE server's response to a query.
+type Response struct {
+	ResultCode int
+	Output     string
+}
+
+// Generate a query's buffer from a command and its arguments.
+func queryBuffer(command string, args []string) string {
+	return strings.Join(append([]string{command}, args...), "!")
+}
+
+// Query runs a command with the specified arguments on the server. The
+// context's deadline applies to the whole exchange.
+func (c *Client) Query(ctx context.Context, command string, args []string) (*Response, error) {
+	for _, arg := range append([]string{command}, args...) {
+		if strings.Contains(arg, "!") {
+			return nil, fmt.Errorf("NRPE commands and arguments may not contain '!'")
+		}
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if c.TLSConfig != nil {
+		tlsConfig := c.TLSConfig
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(c.Address)
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	version := c.Version
+	if version == 0 {
+		version = PACKET_VERSION_3
+	}
+	query := &Packet{
+		Version: version,
+		Type:    QUERY_PACKET,
+		Buffer:  queryBuffer(command, args),
+	}
+	if _, err := query.WriteTo(conn); err != nil {
+		return nil, err
+	}
+	response, err := ReadPacket(conn)
+	if err != nil {
+		return nil, err
+	}
+	if response.Type != RESPONSE_PACKET {
+		return nil, fmt.Errorf("unexpected NRPE packet type %d", response.Type)
+	}
+	return &Response{
+		ResultCode: int(response.ResultCode),
+		Output:     response.Buffer,
+	}, nil
+}
@@ -0,0 +1,162 @@
+// Package nrpe implements the NRPE protocol, which is used to run monitoring
+// checks on remote hosts, using either version 2 or version 3 packets.
+package nrpe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// DefaultPort is the TCP port on which NRPE servers usually listen.
+const DefaultPort = 5666
+
+// Versions of the NRPE packets.
+const (
+	PACKET_VERSION_2 = 2
+	PACKET_VERSION_3 = 3
+)
+
+// Types of NRPE packets.
+const (
+	QUERY_PACKET    = 1
+	RESPONSE_PACKET = 2
+)
+
+// Sizes used in NRPE packets.
+const (
+	// Size of the buffer in version 2 packets.
+	v2BufferSize = 1024
+	// Size of a version 2 packet, including the structure's padding.
+	v2PacketSize = 1036
+	// Size of the header of a version 3 packet.
+	v3HeaderSize = 16
+	// Size of the version 3 packet structure without its buffer.
+	v3StructSize = 19
+	// Maximal size of the buffer of a version 3 packet.
+	v3MaxBufferSize = 65536
+)
+
+// Packet is a NRPE query or response.
+type Packet struct {
+	Version    int16
+	Type       int16
+	ResultCode int16
+	Buffer     string
+}
+
+// Compute a packet's CRC; the CRC field must be zero.
+func packetCRC(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+// Encode the packet. Version 2 packets have a fixed size, and their buffer
+// is truncated if necessary. Version 3 packets have a variable size, but
+// their buffer is never smaller than that of version 2 packets.
+func (p *Packet) Encode() ([]byte, error) {
+	var data []byte
+	switch p.Version {
+	case PACKET_VERSION_2:
+		data = make([]byte, v2PacketSize)
+		buffer := p.Buffer
+		if len(buffer) >= v2BufferSize {
+			buffer = buffer[:v2BufferSize-1]
+		}
+		copy(data[10:], buffer)
+	case PACKET_VERSION_3:
+		if len(p.Buffer) >= v3MaxBufferSize {
+			return nil, fmt.Errorf("NRPE packet buffer too large")
+		}
+		size := v3StructSize + len(p.Buffer) + 1
+		if size < v2PacketSize {
+			size = v2PacketSize
+		}
+		data = make([]byte, size)
+		binary.BigEndian.PutUint32(data[12:], uint32(size-v3StructSize))
+		copy(data[v3HeaderSize:], p.Buffer)
+	default:
+		return nil, fmt.Errorf("unsupported NRPE packet version %d", p.Version)
+	}
+	binary.BigEndian.PutUint16(data[0:], uint16(p.Version))
+	binary.BigEndian.PutUint16(data[2:], uint16(p.Type))
+	binary.BigEndian.PutUint16(data[8:], uint16(p.ResultCode))
+	binary.BigEndian.PutUint32(data[4:], packetCRC(data))
+	return data, nil
+}
+
+// WriteTo encodes the packet and writes it to the specified writer.
+func (p *Packet) WriteTo(w io.Writer) (int64, error) {
+	data, err := p.Encode()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// Extract a string from a NUL-terminated buffer.
+func bufferString(buffer []byte) string {
+	if end := bytes.IndexByte(buffer, 0); end != -1 {
+		buffer = buffer[:end]
+	}
+	return string(buffer)
+}
+
+// ReadPacket reads a version 2 or version 3 packet and checks its CRC.
+func ReadPacket(r io.Reader) (*Packet, error) {
+	header := make([]byte, v3HeaderSize)
+	if _, err := io.ReadFull(r, header[:10]); err != nil {
+		return nil, fmt.Errorf("could not read NRPE packet: %w", err)
+	}
+	p := &Packet{
+		Version:    int16(binary.BigEndian.Uint16(header[0:])),
+		Type:       int16(binary.BigEndian.Uint16(header[2:])),
+		ResultCode: int16(binary.BigEndian.Uint16(header[8:])),
+	}
+	crc := binary.BigEndian.Uint32(header[4:])
+	binary.BigEndian.PutUint32(header[4:], 0)
+
+	var data []byte
+	var buffer []byte
+	// The data over which the CRC may be computed. Version 3 implementations
+	// may include the structure's padding, which is not sent, in the CRC.
+	var candidates [][]byte
+	switch p.Version {
+	case PACKET_VERSION_2:
+		data = make([]byte, v2PacketSize)
+		copy(data, header[:10])
+		if _, err := io.ReadFull(r, data[10:]); err != nil {
+			return nil, fmt.Errorf("could not read NRPE packet: %w", err)
+		}
+		buffer = data[10 : 10+v2BufferSize]
+		candidates = [][]byte{data}
+	case PACKET_VERSION_3:
+		if _, err := io.ReadFull(r, header[10:]); err != nil {
+			return nil, fmt.Errorf("could not read NRPE packet: %w", err)
+		}
+		size := binary.BigEndian.Uint32(header[12:])
+		if size == 0 || size > v3MaxBufferSize {
+			return nil, fmt.Errorf("invalid NRPE packet buffer size %d", size)
+		}
+		data = make([]byte, v3HeaderSize+int(size)+v3StructSize-v3HeaderSize)
+		copy(data, header)
+		if _, err := io.ReadFull(r, data[v3HeaderSize:v3HeaderSize+int(size)]); err != nil {
+			return nil, fmt.Errorf("could not read NRPE packet: %w", err)
+		}
+		buffer = data[v3HeaderSize : v3HeaderSize+int(size)]
+		for padding := v3StructSize - v3HeaderSize; padding >= 0; padding-- {
+			candidates = append(candidates, data[:v3HeaderSize+int(size)+padding])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported NRPE packet version %d", p.Version)
+	}
+	for _, candidate := range candidates {
+		if packetCRC(candidate) == crc {
+			p.Buffer = bufferString(buffer)
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid NRPE packet CRC")
+}
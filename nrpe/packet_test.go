@@ -0,0 +1,72 @@
+package nrpe
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	tests := []struct {
+		packet Packet
+		size   int
+		want   string
+	}{
+		{Packet{PACKET_VERSION_2, QUERY_PACKET, 0, "check_load!1!2"}, 1036, "check_load!1!2"},
+		{Packet{PACKET_VERSION_2, RESPONSE_PACKET, 2, long}, 1036, long[:1023]},
+		{Packet{PACKET_VERSION_3, QUERY_PACKET, 0, "check_load"}, 1036, "check_load"},
+		{Packet{PACKET_VERSION_3, RESPONSE_PACKET, 1, long}, 5020, long},
+	}
+	for _, test := range tests {
+		data, err := test.packet.Encode()
+		if err != nil {
+			t.Errorf("%d/%d: unexpected error %v", test.packet.Version, test.packet.Type, err)
+			continue
+		}
+		if len(data) != test.size {
+			t.Errorf("%d/%d: got %d bytes, want %d", test.packet.Version, test.packet.Type, len(data), test.size)
+		}
+		p, err := ReadPacket(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%d/%d: unexpected error %v", test.packet.Version, test.packet.Type, err)
+			continue
+		}
+		want := test.packet
+		want.Buffer = test.want
+		if *p != want {
+			t.Errorf("%d/%d: got %+v", test.packet.Version, test.packet.Type, *p)
+		}
+	}
+}
+
+func TestPacketV2Layout(t *testing.T) {
+	data, _ := (&Packet{PACKET_VERSION_2, QUERY_PACKET, 0, "_NRPE_CHECK"}).Encode()
+	if !bytes.Equal(data[:4], []byte{0, 2, 0, 1}) || string(data[10:21]) != "_NRPE_CHECK" || data[21] != 0 {
+		t.Errorf("unexpected packet layout %v", data[:24])
+	}
+}
+
+func TestReadPacketErrors(t *testing.T) {
+	valid, _ := (&Packet{PACKET_VERSION_3, QUERY_PACKET, 0, "check_load"}).Encode()
+	corrupt := append([]byte{}, valid...)
+	corrupt[20] = 'X'
+	badVersion := append([]byte{}, valid...)
+	badVersion[1] = 4
+	tooLarge := append([]byte{}, valid...)
+	copy(tooLarge[12:], []byte{0xff, 0xff, 0xff, 0xff})
+	for name, data := range map[string][]byte{
+		"truncated": valid[:100],
+		"corrupt":   corrupt,
+		"version":   badVersion,
+		"too large": tooLarge,
+		"empty":     nil,
+	} {
+		if _, err := ReadPacket(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := (&Packet{Version: 4}).Encode(); err == nil {
+		t.Errorf("unsupported version: expected an error")
+	}
+}
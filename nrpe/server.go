@@ -0,0 +1,144 @@
+package nrpe
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Command that NRPE clients send in order to check the server's version.
+const versionCommand = "_NRPE_CHECK"
+
+// Characters that may not appear in the arguments of a query.
+const nastyMetachars = "|`&><'\"\\[]{};\r\n"
+
+// Result code used when a query cannot be executed.
+const unknownCode = 3
+
+// Handler executes the command requested by a query and returns the result
+// code and output.
+type Handler func(command string, args []string) (int, string)
+
+// Server answers NRPE queries.
+type Server struct {
+	// Handler executes the commands.
+	Handler Handler
+	// AllowedHosts lists the networks from which queries are accepted. All
+	// hosts are allowed if it is empty.
+	AllowedHosts []*net.IPNet
+	// AllowArguments indicates whether queries may include arguments.
+	AllowArguments bool
+	// Version is the version string sent in response to version checks.
+	Version string
+	// Timeout is the maximal duration of the reception of a query.
+	Timeout time.Duration
+
+	wg sync.WaitGroup
+}
+
+// ParseAllowedHost converts an IP address or a network in CIDR notation to
+// a network.
+func ParseAllowedHost(spec string) (*net.IPNet, error) {
+	if strings.Contains(spec, "/") {
+		_, network, err := net.ParseCIDR(spec)
+		return network, err
+	}
+	ip := net.ParseIP(spec)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address '%s'", spec)
+	}
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Check whether a connection comes from an allowed host.
+func (s *Server) allowed(addr net.Addr) bool {
+	if len(s.AllowedHosts) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range s.AllowedHosts {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute a query and return the result code and output.
+func (s *Server) execute(buffer string) (int, string) {
+	parts := strings.Split(buffer, "!")
+	command, args := parts[0], parts[1:]
+	if command == versionCommand {
+		return 0, "NRPE v" + s.Version
+	}
+	if len(args) != 0 {
+		if !s.AllowArguments {
+			return unknownCode, "NRPE: command arguments are not allowed"
+		}
+		for _, arg := range args {
+			if strings.ContainsAny(arg, nastyMetachars) {
+				return unknownCode, "NRPE: command arguments contain forbidden characters"
+			}
+		}
+	}
+	return s.Handler(command, args)
+}
+
+// Handle a connection: read the query, execute it and send the response
+// using the query's packet version.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	if !s.allowed(conn.RemoteAddr()) {
+		return
+	}
+	if s.Timeout != 0 {
+		conn.SetReadDeadline(time.Now().Add(s.Timeout))
+	}
+	query, err := ReadPacket(conn)
+	if err != nil || query.Type != QUERY_PACKET {
+		return
+	}
+	code, output := s.execute(query.Buffer)
+	conn.SetReadDeadline(time.Time{})
+	if s.Timeout != 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.Timeout))
+	}
+	response := &Packet{
+		Version:    query.Version,
+		Type:       RESPONSE_PACKET,
+		ResultCode: int16(code),
+		Buffer:     output,
+	}
+	response.WriteTo(conn)
+}
+
+// Serve accepts connections on the listener and handles them until the
+// listener is closed. Connections that are being handled when the listener
+// is closed are allowed to complete.
+func (s *Server) Serve(listener net.Listener) error {
+	defer s.wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
@@ -0,0 +1,170 @@
+package nrpe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Handler that echoes the command and its arguments.
+func echoHandler(command string, args []string) (int, string) {
+	if command == "fail" {
+		return 2, "failed"
+	}
+	return 0, command + "(" + strings.Join(args, ",") + ")"
+}
+
+// Generate a self-signed server certificate for 127.0.0.1.
+func serverCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nrpe"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// Start a server on a local port. Returns its address and a function that
+// stops it.
+func startServer(t *testing.T, server *Server, tlsConfig *tls.Config) (string, func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	done := make(chan struct{})
+	go func() {
+		server.Serve(listener)
+		close(done)
+	}()
+	return listener.Addr().String(), func() {
+		listener.Close()
+		<-done
+	}
+}
+
+func TestClientServer(t *testing.T) {
+	cert, pool := serverCertificate(t)
+	for _, useTLS := range []bool{false, true} {
+		var serverTLS, clientTLS *tls.Config
+		if useTLS {
+			serverTLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+			clientTLS = &tls.Config{RootCAs: pool}
+		}
+		address, stop := startServer(t, &Server{
+			Handler:        echoHandler,
+			AllowArguments: true,
+			Version:        "test",
+			Timeout:        time.Second,
+		}, serverTLS)
+
+		tests := []struct {
+			version int16
+			command string
+			args    []string
+			code    int
+			output  string
+		}{
+			{PACKET_VERSION_3, "check", []string{"a", "b c"}, 0, "check(a,b c)"},
+			{PACKET_VERSION_2, "check", nil, 0, "check()"},
+			{PACKET_VERSION_3, "fail", nil, 2, "failed"},
+			{PACKET_VERSION_2, "_NRPE_CHECK", nil, 0, "NRPE vtest"},
+			{PACKET_VERSION_3, "check", []string{"$(reboot)", "a;b"}, 3,
+				"NRPE: command arguments contain forbidden characters"},
+		}
+		for _, test := range tests {
+			client := &Client{Address: address, TLSConfig: clientTLS, Version: test.version}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			response, err := client.Query(ctx, test.command, test.args)
+			cancel()
+			if err != nil {
+				t.Errorf("TLS %v, %s: unexpected error %v", useTLS, test.command, err)
+				continue
+			}
+			if response.ResultCode != test.code || response.Output != test.output {
+				t.Errorf("TLS %v, %s: got %d %q, want %d %q", useTLS, test.command,
+					response.ResultCode, response.Output, test.code, test.output)
+			}
+		}
+		stop()
+	}
+}
+
+func TestServerRestrictions(t *testing.T) {
+	other, _ := ParseAllowedHost("192.0.2.0/24")
+	address, stop := startServer(t, &Server{Handler: echoHandler}, nil)
+	defer stop()
+	client := &Client{Address: address}
+	response, err := client.Query(context.Background(), "check", []string{"arg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ResultCode != 3 || response.Output != "NRPE: command arguments are not allowed" {
+		t.Errorf("got %d %q", response.ResultCode, response.Output)
+	}
+	if _, err := client.Query(context.Background(), "check!arg", nil); err == nil {
+		t.Errorf("command containing '!': expected an error")
+	}
+
+	restricted, stopRestricted := startServer(t, &Server{
+		Handler:      echoHandler,
+		AllowedHosts: []*net.IPNet{other},
+	}, nil)
+	defer stopRestricted()
+	client = &Client{Address: restricted}
+	if _, err := client.Query(context.Background(), "check", nil); err == nil {
+		t.Errorf("query from a forbidden host succeeded")
+	}
+}
+
+func TestParseAllowedHost(t *testing.T) {
+	tests := map[string]string{
+		"127.0.0.1":     "127.0.0.1/32",
+		"10.0.0.0/8":    "10.0.0.0/8",
+		"::1":           "::1/128",
+		"2001:db8::/32": "2001:db8::/32",
+	}
+	for spec, want := range tests {
+		network, err := ParseAllowedHost(spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", spec, err)
+		} else if network.String() != want {
+			t.Errorf("%s: got %s, want %s", spec, network, want)
+		}
+	}
+	for _, spec := range []string{"", "host.example.org", "10.0.0.0/33"} {
+		if _, err := ParseAllowedHost(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package perfdata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormat indicates how performance data is rendered when it is
+// exported to a time series database.
+type ExportFormat int
+
+// Export formats.
+const (
+	// Graphite plaintext protocol.
+	EXPORT_GRAPHITE ExportFormat = iota
+	// InfluxDB line protocol.
+	EXPORT_INFLUXDB
+	// OpenMetrics text format.
+	EXPORT_OPENMETRICS
+)
+
+// String representations of the export formats.
+func (f ExportFormat) String() string {
+	return [...]string{"graphite", "influxdb", "openmetrics"}[f]
+}
+
+// ParseExportFormat converts the name of an export format to the
+// corresponding value.
+func ParseExportFormat(name string) (ExportFormat, error) {
+	for f := EXPORT_GRAPHITE; f <= EXPORT_OPENMETRICS; f++ {
+		if f.String() == name {
+			return f, nil
+		}
+	}
+	return EXPORT_GRAPHITE, fmt.Errorf("unsupported metrics format '%s'", name)
+}
+
+// ExportSource describes where exported performance data comes from. The
+// plugin and host names are used as tags or as parts of the metrics' names,
+// depending on the format. The time is used as the samples' timestamp; in
+// the OpenMetrics format, it is optional and omitted if it is zero.
+type ExportSource struct {
+	Plugin string
+	Host   string
+	Time   time.Time
+}
+
+// Value returns the performance data's value as a number. The second value
+// is false if the value is unknown.
+func (d *PerfData) Value() (float64, bool) {
+	if d.value == "U" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(d.value, 64)
+	return v, err == nil
+}
+
+// Export writes the performance data records to the specified writer using
+// the specified format. Records with unknown values are skipped.
+func Export(w io.Writer, format ExportFormat, source ExportSource, records []*PerfData) error {
+	switch format {
+	case EXPORT_INFLUXDB:
+		return WriteInfluxDB(w, source, records)
+	case EXPORT_OPENMETRICS:
+		return WriteOpenMetrics(w, source, records)
+	}
+	return WriteGraphite(w, source, records)
+}
+
+// Regexp that matches characters that may not be used in a Graphite path
+// component.
+var graphiteInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// Convert a string to a Graphite path component.
+func graphiteComponent(s string) string {
+	return strings.Trim(graphiteInvalid.ReplaceAllString(s, "_"), "_")
+}
+
+// WriteGraphite writes the performance data records using Graphite's
+// plaintext protocol. Each record's path is made of the host name, plugin
+// name and label, from which unsupported characters are removed.
+func WriteGraphite(w io.Writer, source ExportSource, records []*PerfData) error {
+	bw := bufio.NewWriter(w)
+	prefix := graphiteComponent(source.Host) + "." + graphiteComponent(source.Plugin) + "."
+	for _, d := range records {
+		value, ok := d.Value()
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(bw, "%s%s %s %d\n", prefix, graphiteComponent(d.Label),
+			formatExported(value), source.Time.Unix())
+	}
+	return bw.Flush()
+}
+
+// Escape characters in InfluxDB measurement names, tag keys and tag values.
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
+
+// WriteInfluxDB writes the performance data records using InfluxDB's line
+// protocol. The plugin name is used as the measurement, the host, label and
+// unit are added as tags, and the value and minimal and maximal values are
+// written as fields.
+func WriteInfluxDB(w io.Writer, source ExportSource, records []*PerfData) error {
+	bw := bufio.NewWriter(w)
+	for _, d := range records {
+		value, ok := d.Value()
+		if !ok {
+			continue
+		}
+		bw.WriteString(influxMeasurementEscaper.Replace(source.Plugin))
+		fmt.Fprintf(bw, ",host=%s,label=%s", influxTagEscaper.Replace(source.Host),
+			influxTagEscaper.Replace(d.Label))
+		if d.units != UOM_NONE {
+			fmt.Fprintf(bw, ",unit=%s", influxTagEscaper.Replace(d.units.String()))
+		}
+		fmt.Fprintf(bw, " value=%s", formatExported(value))
+		if d.bits&PDAT_MIN != 0 {
+			fmt.Fprintf(bw, ",min=%s", d.min)
+		}
+		if d.bits&PDAT_MAX != 0 {
+			fmt.Fprintf(bw, ",max=%s", d.max)
+		}
+		fmt.Fprintf(bw, " %d\n", source.Time.UnixNano())
+	}
+	return bw.Flush()
+}
+
+// Regexp that matches characters that may not be used in OpenMetrics metric
+// names.
+var openMetricsInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// Escape characters in OpenMetrics label values.
+var openMetricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Names of the OpenMetrics units that correspond to base units.
+var openMetricsUnits = map[UnitOfMeasurement]string{
+	UOM_SECONDS: "seconds",
+	UOM_BYTES:   "bytes",
+}
+
+// Convert a performance data label to an OpenMetrics metric name.
+func openMetricsName(label string) string {
+	name := strings.Trim(openMetricsInvalid.ReplaceAllString(label, "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// OpenMetricsLabel is a label that is attached to OpenMetrics samples.
+type OpenMetricsLabel struct {
+	Name  string
+	Value string
+}
+
+// Render a set of OpenMetrics labels.
+func openMetricsLabels(labels []OpenMetricsLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf(`%s="%s"`, l.Name, openMetricsLabelEscaper.Replace(l.Value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// A metric family in an OpenMetrics exposition, with its rendered samples.
+type openMetricsFamily struct {
+	name    string
+	kind    string
+	unit    string
+	help    string
+	samples []string
+}
+
+// OpenMetricsExposition collects metric families and writes them using the
+// OpenMetrics text format. Samples are grouped by family, so that the
+// performance data of several sources may be combined in an exposition.
+type OpenMetricsExposition struct {
+	families []*openMetricsFamily
+	byName   map[string]*openMetricsFamily
+	used     map[string]bool
+	records  map[string]*openMetricsFamily
+}
+
+// NewOpenMetricsExposition creates an empty OpenMetrics exposition.
+func NewOpenMetricsExposition() *OpenMetricsExposition {
+	return &OpenMetricsExposition{
+		byName:  make(map[string]*openMetricsFamily),
+		used:    make(map[string]bool),
+		records: make(map[string]*openMetricsFamily),
+	}
+}
+
+// Add a family to the exposition. Counter families also reserve the name
+// of their samples.
+func (e *OpenMetricsExposition) addFamily(name, kind, unit, help string) *openMetricsFamily {
+	family := &openMetricsFamily{name: name, kind: kind, unit: unit, help: help}
+	e.families = append(e.families, family)
+	e.byName[name] = family
+	e.used[name] = true
+	if kind == "counter" {
+		e.used[name+"_total"] = true
+	}
+	return family
+}
+
+// Select the name of a new metric family for a performance data label,
+// appending a number to the name if it is already used by another family.
+func (e *OpenMetricsExposition) familyName(label, unit string, counter bool) string {
+	base := openMetricsName(label)
+	suffix := ""
+	if unit != "" {
+		suffix = "_" + unit
+		if trimmed := strings.TrimSuffix(base, suffix); trimmed != "" {
+			base = trimmed
+		}
+	}
+	taken := func(name string) bool {
+		return e.used[name] || (counter && e.used[name+"_total"])
+	}
+	name := base + suffix
+	for i := 2; taken(name); i++ {
+		name = fmt.Sprintf("%s_%d%s", base, i, suffix)
+	}
+	return name
+}
+
+// AddGauge adds a sample to a gauge family, which is created with the
+// specified unit and help text if it does not exist yet.
+func (e *OpenMetricsExposition) AddGauge(name, unit, help string, labels []OpenMetricsLabel, value float64) {
+	family, ok := e.byName[name]
+	if !ok {
+		family = e.addFamily(name, "gauge", unit, help)
+	}
+	family.samples = append(family.samples, fmt.Sprintf("%s%s %s", name, openMetricsLabels(labels),
+		formatExported(value)))
+}
+
+// AddPerfData adds performance data records to the exposition, with the
+// specified labels and, if it is not zero, timestamp. Each record belongs to
+// a metric family named after its label; the records of different sources
+// that have the same label and unit share a family, while labels that map
+// to the name of another family get a number appended to their name.
+// Durations and sizes are converted to seconds and bytes, counters are
+// exposed as such, and records with unknown values are skipped.
+func (e *OpenMetricsExposition) AddPerfData(labels []OpenMetricsLabel, t time.Time, records []*PerfData) {
+	rendered := openMetricsLabels(labels)
+	timestamp := ""
+	if !t.IsZero() {
+		timestamp = " " + strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+	}
+	seen := make(map[string]int)
+	for _, d := range records {
+		value, ok := d.Value()
+		if !ok {
+			continue
+		}
+		base := d.units.BaseUnit()
+		value, _ = ConvertValue(value, d.units, base)
+		unit := openMetricsUnits[base]
+		counter := d.units == UOM_COUNTER
+		key := fmt.Sprintf("%s\x00%s\x00%t", d.Label, unit, counter)
+		seen[key]++
+		key = fmt.Sprintf("%s\x00%d", key, seen[key])
+		family, ok := e.records[key]
+		if !ok {
+			kind := "gauge"
+			if counter {
+				kind = "counter"
+			}
+			family = e.addFamily(e.familyName(d.Label, unit, counter), kind, unit, "")
+			e.records[key] = family
+		}
+		sample := family.name
+		if counter {
+			sample += "_total"
+		}
+		family.samples = append(family.samples, fmt.Sprintf("%s%s %s%s", sample, rendered,
+			formatExported(value), timestamp))
+	}
+}
+
+// Write writes the exposition using the OpenMetrics text format.
+func (e *OpenMetricsExposition) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, family := range e.families {
+		fmt.Fprintf(bw, "# TYPE %s %s\n", family.name, family.kind)
+		if family.unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", family.name, family.unit)
+		}
+		if family.help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", family.name, openMetricsLabelEscaper.Replace(family.help))
+		}
+		for _, sample := range family.samples {
+			fmt.Fprintln(bw, sample)
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// WriteOpenMetrics writes the performance data records using the OpenMetrics
+// text format. Each record is written as a metric family named after its
+// label, with the host and plugin names as labels (see AddPerfData). The
+// samples only have a timestamp if the source's time is set, as some
+// consumers (e.g. the node exporter's textfile collector) reject them. The
+// output is a complete exposition, so it cannot be appended to another one.
+func WriteOpenMetrics(w io.Writer, source ExportSource, records []*PerfData) error {
+	e := NewOpenMetricsExposition()
+	e.AddPerfData([]OpenMetricsLabel{
+		{Name: "host", Value: source.Host},
+		{Name: "plugin", Value: source.Plugin},
+	}, source.Time, records)
+	return e.Write(w)
+}
+
+// Format an exported value.
+func formatExported(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,171 @@
+package perfdata
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Build the records and source used by the export tests.
+func exportTestData() (ExportSource, []*PerfData) {
+	source := ExportSource{
+		Plugin: "Zone check",
+		Host:   "ns1.example.org",
+		Time:   time.Unix(1600000000, 500000000),
+	}
+	rtt := New("checked rtt", UOM_MILLISECONDS, "12")
+	rtt.SetMin("0")
+	size := New("size", UOM_KILOBYTES, "2")
+	size.SetMax("1024")
+	return source, []*PerfData{
+		rtt,
+		New("unknown", UOM_NONE, ""),
+		size,
+		New("queries", UOM_COUNTER, "1234"),
+	}
+}
+
+func TestParseExportFormat(t *testing.T) {
+	for _, format := range []ExportFormat{EXPORT_GRAPHITE, EXPORT_INFLUXDB, EXPORT_OPENMETRICS} {
+		if got, err := ParseExportFormat(format.String()); err != nil || got != format {
+			t.Errorf("%v: got %v, %v", format, got, err)
+		}
+	}
+	if _, err := ParseExportFormat("statsd"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		format ExportFormat
+		want   string
+	}{
+		{
+			EXPORT_GRAPHITE,
+			"ns1_example_org.Zone_check.checked_rtt 12 1600000000\n" +
+				"ns1_example_org.Zone_check.size 2 1600000000\n" +
+				"ns1_example_org.Zone_check.queries 1234 1600000000\n",
+		},
+		{
+			EXPORT_INFLUXDB,
+			`Zone\ check,host=ns1.example.org,label=checked\ rtt,unit=ms value=12,min=0 1600000000500000000` + "\n" +
+				`Zone\ check,host=ns1.example.org,label=size,unit=KB value=2,max=1024 1600000000500000000` + "\n" +
+				`Zone\ check,host=ns1.example.org,label=queries,unit=c value=1234 1600000000500000000` + "\n",
+		},
+		{
+			EXPORT_OPENMETRICS,
+			"# TYPE checked_rtt_seconds gauge\n" +
+				"# UNIT checked_rtt_seconds seconds\n" +
+				`checked_rtt_seconds{host="ns1.example.org",plugin="Zone check"} 0.012 1600000000.500` + "\n" +
+				"# TYPE size_bytes gauge\n" +
+				"# UNIT size_bytes bytes\n" +
+				`size_bytes{host="ns1.example.org",plugin="Zone check"} 2048 1600000000.500` + "\n" +
+				"# TYPE queries counter\n" +
+				`queries_total{host="ns1.example.org",plugin="Zone check"} 1234 1600000000.500` + "\n" +
+				"# EOF\n",
+		},
+	}
+	source, records := exportTestData()
+	for _, test := range tests {
+		var sb strings.Builder
+		if err := Export(&sb, test.format, source, records); err != nil {
+			t.Errorf("%v: unexpected error %v", test.format, err)
+			continue
+		}
+		if got := sb.String(); got != test.want {
+			t.Errorf("%v: got\n%s\nwant\n%s", test.format, got, test.want)
+		}
+	}
+}
+
+func TestOpenMetricsWithoutTimestamp(t *testing.T) {
+	source, records := exportTestData()
+	source.Time = time.Time{}
+	var sb strings.Builder
+	if err := WriteOpenMetrics(&sb, source, records[:1]); err != nil {
+		t.Fatal(err)
+	}
+	want := "# TYPE checked_rtt_seconds gauge\n" +
+		"# UNIT checked_rtt_seconds seconds\n" +
+		`checked_rtt_seconds{host="ns1.example.org",plugin="Zone check"} 0.012` + "\n" +
+		"# EOF\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestOpenMetricsName(t *testing.T) {
+	tests := map[string]string{
+		"validity":    "validity",
+		"disk /var":   "disk_var",
+		"5m load":     "_5m_load",
+		"'weird'=one": "weird_one",
+	}
+	for label, want := range tests {
+		if got := openMetricsName(label); got != want {
+			t.Errorf("%q: got %q, want %q", label, got, want)
+		}
+	}
+}
+
+func TestOpenMetricsDuplicateNames(t *testing.T) {
+	source, _ := exportTestData()
+	records := []*PerfData{
+		New("disk /var", UOM_NONE, "1"),
+		New("disk_var", UOM_NONE, "2"),
+		New("time", UOM_SECONDS, "3"),
+		New("time_seconds", UOM_MILLISECONDS, "4"),
+		New("hits_total", UOM_NONE, "5"),
+		New("hits", UOM_COUNTER, "6"),
+	}
+	var sb strings.Builder
+	if err := WriteOpenMetrics(&sb, source, records); err != nil {
+		t.Fatal(err)
+	}
+	var families []string
+	for _, line := range strings.Split(sb.String(), "\n") {
+		if strings.HasPrefix(line, "# TYPE ") {
+			families = append(families, strings.Fields(line)[2])
+		}
+	}
+	want := []string{"disk_var", "disk_var_2", "time_seconds", "time_2_seconds", "hits_total", "hits_2"}
+	if strings.Join(families, " ") != strings.Join(want, " ") {
+		t.Errorf("got families %q, want %q", families, want)
+	}
+}
+
+func TestOpenMetricsExposition(t *testing.T) {
+	e := NewOpenMetricsExposition()
+	e.AddGauge("check_status", "", `Status of "checks".`, []OpenMetricsLabel{{"check", "a"}}, 0)
+	e.AddGauge("check_status", "", "", []OpenMetricsLabel{{"check", "b\n"}}, 2)
+	e.AddPerfData([]OpenMetricsLabel{{"check", "a"}}, time.Time{}, []*PerfData{
+		New("rtt", UOM_MILLISECONDS, "12"),
+		New("rtt", UOM_MILLISECONDS, "15"),
+	})
+	e.AddPerfData([]OpenMetricsLabel{{"check", "b\n"}}, time.Time{}, []*PerfData{
+		New("check status", UOM_NONE, "1"),
+		New("rtt", UOM_SECONDS, "1"),
+	})
+	var sb strings.Builder
+	if err := e.Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := "# TYPE check_status gauge\n" +
+		`# HELP check_status Status of \"checks\".` + "\n" +
+		`check_status{check="a"} 0` + "\n" +
+		`check_status{check="b\n"} 2` + "\n" +
+		"# TYPE rtt_seconds gauge\n" +
+		"# UNIT rtt_seconds seconds\n" +
+		`rtt_seconds{check="a"} 0.012` + "\n" +
+		`rtt_seconds{check="b\n"} 1` + "\n" +
+		"# TYPE rtt_2_seconds gauge\n" +
+		"# UNIT rtt_2_seconds seconds\n" +
+		`rtt_2_seconds{check="a"} 0.015` + "\n" +
+		"# TYPE check_status_2 gauge\n" +
+		`check_status_2{check="b\n"} 1` + "\n" +
+		"# EOF\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
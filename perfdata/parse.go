@@ -0,0 +1,175 @@
+package perfdata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Regexps used to split a performance data record's value from its units
+// and to recognize values that use the exponent notation.
+var (
+	valueUnitsRegexp = regexp.MustCompile(`^(U|-?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?)([^-+.0-9].*)?$`)
+	exponentRegexp   = regexp.MustCompile(`^-?(?:\d+\.?\d*|\.\d+)[eE][-+]?\d+$`)
+)
+
+// Finds the unit of measurement that corresponds to a string. Units that
+// are not supported are returned as a string.
+func parseUnits(s string) (UnitOfMeasurement, string) {
+	for u := UOM_NONE; u <= UOM_MICROSECONDS; u++ {
+		if u.String() == s {
+			return u, ""
+		}
+	}
+	return UOM_NONE, s
+}
+
+// Check a value read from performance data. Values that use the exponent
+// notation are converted, as it cannot be used in the plugin's output.
+func parseValue(s string) (string, bool) {
+	if valueCheck.MatchString(s) {
+		return s, true
+	}
+	if !exponentRegexp.MatchString(s) {
+		return "", false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", false
+	}
+	value, err := FormatFloat(f, PRECISION_EXACT)
+	return value, err == nil
+}
+
+// Skip the rest of an invalid performance data record.
+func skipRecord(s string) string {
+	end := strings.IndexAny(s, " \t\r\n")
+	if end == -1 {
+		return ""
+	}
+	return s[end:]
+}
+
+// Read a performance data record's label from the start of a string, handling
+// quoted labels. Returns the label and the rest of the string, following the
+// '=' character.
+func parseLabel(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "'") {
+		eq := strings.IndexAny(s, "= \t")
+		if eq <= 0 || s[eq] != '=' {
+			return "", "", fmt.Errorf("invalid performance data '%s'", s)
+		}
+		return s[:eq], s[eq+1:], nil
+	}
+	var sb strings.Builder
+	pos := 1
+	for {
+		q := strings.IndexByte(s[pos:], '\'')
+		if q == -1 {
+			return "", "", fmt.Errorf("unterminated label in performance data '%s'", s)
+		}
+		sb.WriteString(s[pos : pos+q])
+		pos += q + 1
+		if strings.HasPrefix(s[pos:], "'") {
+			sb.WriteByte('\'')
+			pos++
+			continue
+		}
+		break
+	}
+	if !strings.HasPrefix(s[pos:], "=") || sb.Len() == 0 {
+		return "", "", fmt.Errorf("invalid performance data '%s'", s)
+	}
+	return sb.String(), s[pos+1:], nil
+}
+
+// Parse a performance data record from the start of a string. Returns the
+// record and the rest of the string, which follows the record even if it is
+// invalid.
+func parseRecord(s string) (*PerfData, string, error) {
+	label, rest, err := parseLabel(s)
+	if err != nil {
+		if strings.HasPrefix(s, "'") {
+			return nil, "", err
+		}
+		return nil, skipRecord(s), err
+	}
+	end := strings.IndexAny(rest, " \t\r\n")
+	if end == -1 {
+		end = len(rest)
+	}
+	data := strings.TrimSuffix(rest[:end], ",")
+	rest = rest[end:]
+
+	fields := strings.Split(data, ";")
+	if len(fields) > 5 {
+		return nil, rest, fmt.Errorf("too many fields in performance data '%s'", label)
+	}
+	vu := valueUnitsRegexp.FindStringSubmatch(fields[0])
+	if vu == nil {
+		return nil, rest, fmt.Errorf("invalid value in performance data '%s'", label)
+	}
+	value := ""
+	if vu[1] != "U" {
+		var ok bool
+		if value, ok = parseValue(vu[1]); !ok {
+			return nil, rest, fmt.Errorf("invalid value in performance data '%s'", label)
+		}
+	}
+	units, unitName := parseUnits(vu[2])
+	pd := New(label, units, value)
+	pd.unitName = unitName
+	for i, setter := range []func(*PerfDataRange){pd.SetWarn, pd.SetCrit} {
+		if len(fields) <= i+1 || fields[i+1] == "" {
+			continue
+		}
+		r, err := ParseRange(fields[i+1])
+		if err != nil {
+			return nil, rest, fmt.Errorf("performance data '%s': %v", label, err)
+		}
+		setter(r)
+	}
+	for i, setter := range []func(string){pd.SetMin, pd.SetMax} {
+		if len(fields) <= i+3 || fields[i+3] == "" {
+			continue
+		}
+		boundary, ok := parseValue(fields[i+3])
+		if !ok {
+			return nil, rest, fmt.Errorf("invalid boundary in performance data '%s'", label)
+		}
+		setter(boundary)
+	}
+	return pd, rest, nil
+}
+
+// Parse reads a list of performance data records, as found after the '|'
+// character in a plugin's output. Records may be separated by whitespace
+// and/or commas. Labels may be quoted, with quotes inside the label being
+// doubled. Units of measurement that are not supported are preserved, but
+// the records' values cannot be converted.
+//
+// Invalid records are skipped. The other records are returned along with an
+// error that describes the invalid records.
+func Parse(s string) ([]*PerfData, error) {
+	result := make([]*PerfData, 0)
+	var errs []string
+	rest := s
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n,")
+		if rest == "" {
+			break
+		}
+		pd, next, err := parseRecord(rest)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			result = append(result, pd)
+		}
+		rest = next
+	}
+	if len(errs) != 0 {
+		return result, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package perfdata
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", []string{}},
+		{"time=0.5s", []string{"time=0.5s;;;;"}},
+		{"time=0.5s;1;2;0;10", []string{"time=0.5s;:1;:2;0;10"}},
+		{"a=1 b=2%;;;0;100", []string{"a=1;;;;", "b=2%;;;0;100"}},
+		{"a=1;;;;, b=U;~:10;@5:", []string{"a=1;;;;", "b=U;~:10;@5:;;"}},
+		{"'with space'=3c", []string{"'with space'=3c;;;;"}},
+		{"'it''s'=4B", []string{"'it''s'=4B;;;;"}},
+		{"  x=-1.5KB;10:;;;  ", []string{"x=-1.5KB;10:;;;"}},
+		{"in=12KiB out=5bps;;;0;", []string{"in=12KiB;;;;", "out=5bps;;;0;"}},
+		{"'eth0_traffic_in'=10.50Bits/s;;;0;", []string{"eth0_traffic_in=10.50Bits/s;;;0;"}},
+		{"temp=1.5e-3 big=2E+3c;;;-1e2;1e3", []string{"temp=0.0015;;;;", "big=2000c;;;-100;1000"}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %d records, want %d", test.input, len(got), len(test.want))
+			continue
+		}
+		for i := range got {
+			if s := got[i].String(); s != test.want[i] {
+				t.Errorf("%q: record %d: got %q, want %q", test.input, i, s, test.want[i])
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"novalue",
+		"=1",
+		"a b=1",
+		"'unterminated=1",
+		"''=1",
+		"a=x",
+		"a=1.2.3",
+		"a=1;x",
+		"a=1;;;y",
+		"a=1;;;;;",
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestParseSkipsInvalid(t *testing.T) {
+	got, err := Parse("a=1 b=x 'c d=2 e=1;;;y")
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if len(got) != 1 || got[0].String() != "a=1;;;;" {
+		t.Errorf("got %q, want only the first record", got)
+	}
+	got, err = Parse("a=x b=2KiB, c=3")
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if len(got) != 2 || got[0].String() != "b=2KiB;;;;" || got[1].String() != "c=3;;;;" {
+		t.Errorf("got %q, want the last two records", got)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	pd := New("it's a 'label'=x", UOM_MEGABYTES, "12.5")
+	pd.SetWarn(PDRMax("20"))
+	pd.SetCrit(PDRMinMax("~", "30").Inside())
+	pd.SetMin("0")
+	pd.SetMax("100")
+	parsed, err := Parse(pd.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("got %d records, want 1", len(parsed))
+	}
+	if parsed[0].Label != pd.Label || parsed[0].String() != pd.String() {
+		t.Errorf("got %q, want %q", parsed[0], pd)
+	}
+}
@@ -3,8 +3,10 @@
 package perfdata
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -21,10 +23,12 @@ const (
 	UOM_GIGABYTES
 	UOM_TERABYTES
 	UOM_COUNTER
+	UOM_MILLISECONDS
+	UOM_MICROSECONDS
 )
 
 func (u UnitOfMeasurement) String() string {
-	return [...]string{"", "s", "%", "B", "KB", "MB", "GB", "TB", "c"}[u]
+	return [...]string{"", "s", "%", "B", "KB", "MB", "GB", "TB", "c", "ms", "us"}[u]
 }
 
 // Flags indicating which elements of performance data have been set.
@@ -55,30 +59,88 @@ type PerfDataRange struct {
 }
 
 // Creates a performance data range from -inf to 0 and from the specified
-// value to +inf.
+// value to +inf. The program panics if the value is invalid.
 func PDRMax(max string) *PerfDataRange {
+	r, err := CheckedPDRMax(max)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+// Creates a performance data range from -inf to 0 and from the specified
+// value to +inf, returning an error if the value is invalid.
+func CheckedPDRMax(max string) (*PerfDataRange, error) {
 	if !valueCheck.MatchString(max) {
-		panic("invalid performance data range maximum value")
+		return nil, fmt.Errorf("invalid performance data range maximum value '%s'", max)
 	}
 	r := &PerfDataRange{}
 	r.start = "0"
 	r.end = max
-	return r
+	return r, nil
 }
 
 // Creates a performance data range from -inf to the specified minimal value
-// and from the specified maximal value to +inf.
+// and from the specified maximal value to +inf. The program panics if either
+// value is invalid.
 func PDRMinMax(min, max string) *PerfDataRange {
+	r, err := CheckedPDRMinMax(min, max)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+// Creates a performance data range from -inf to the specified minimal value
+// and from the specified maximal value to +inf, returning an error if either
+// value is invalid.
+func CheckedPDRMinMax(min, max string) (*PerfDataRange, error) {
 	if !valueCheck.MatchString(max) {
-		panic("invalid performance data range maximum value")
+		return nil, fmt.Errorf("invalid performance data range maximum value '%s'", max)
 	}
 	if !rangeMinCheck.MatchString(min) {
-		panic("invalid performance data range minimum value")
+		return nil, fmt.Errorf("invalid performance data range minimum value '%s'", min)
 	}
 	r := &PerfDataRange{}
 	r.start = min
 	r.end = max
-	return r
+	return r, nil
+}
+
+// Parses a range using the standard Nagios threshold syntax ("10", "10:",
+// "~:10", "10:20", optionally prefixed with "@" to invert the range).
+func ParseRange(s string) (*PerfDataRange, error) {
+	r := &PerfDataRange{start: "0"}
+	spec := s
+	if strings.HasPrefix(spec, "@") {
+		r.inside = true
+		spec = spec[1:]
+	}
+	if sep := strings.Index(spec, ":"); sep == -1 {
+		if spec == "" {
+			return nil, fmt.Errorf("invalid range '%s': empty range", s)
+		}
+		r.end = spec
+	} else {
+		if sep != 0 {
+			r.start = spec[:sep]
+		}
+		r.end = spec[sep+1:]
+	}
+	if !rangeMinCheck.MatchString(r.start) {
+		return nil, fmt.Errorf("invalid range '%s': bad minimum value", s)
+	}
+	if r.end != "" && !valueCheck.MatchString(r.end) {
+		return nil, fmt.Errorf("invalid range '%s': bad maximum value", s)
+	}
+	if r.start != "~" && r.end != "" {
+		start, _ := strconv.ParseFloat(r.start, 64)
+		end, _ := strconv.ParseFloat(r.end, 64)
+		if start > end {
+			return nil, fmt.Errorf("invalid range '%s': minimum is greater than maximum", s)
+		}
+	}
+	return r, nil
 }
 
 // Inverts the range.
@@ -87,6 +149,22 @@ func (r *PerfDataRange) Inside() *PerfDataRange {
 	return r
 }
 
+// Checks whether a value should cause an alert according to the range. If
+// the range is not inverted, values outside of the range cause alerts;
+// otherwise, values inside of the range do.
+func (r *PerfDataRange) Alert(value float64) bool {
+	inRange := true
+	if r.start != "" && r.start != "~" {
+		start, _ := strconv.ParseFloat(r.start, 64)
+		inRange = value >= start
+	}
+	if inRange && r.end != "" {
+		end, _ := strconv.ParseFloat(r.end, 64)
+		inRange = value <= end
+	}
+	return inRange == r.inside
+}
+
 // Generates the range's string representation so it can be sent to the
 // monitoring system.
 func (r *PerfDataRange) String() string {
@@ -111,16 +189,28 @@ func (r *PerfDataRange) String() string {
 type PerfData struct {
 	Label      string
 	units      UnitOfMeasurement
+	unitName   string // Unsupported unit read from a plugin's output
 	bits       perfDataBits
 	value      string
 	warn, crit PerfDataRange
 	min, max   string
 }
 
-// Create performance data using the specified label and units.
+// Create performance data using the specified label and units. The program
+// panics if the value is invalid.
 func New(label string, units UnitOfMeasurement, value string) *PerfData {
+	r, err := CheckedNew(label, units, value)
+	if err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+// Create performance data using the specified label and units, returning an
+// error if the value is invalid. An empty value is reported as unknown.
+func CheckedNew(label string, units UnitOfMeasurement, value string) (*PerfData, error) {
 	if value != "" && !valueCheck.MatchString(value) {
-		panic("invalid value")
+		return nil, fmt.Errorf("invalid value '%s' for performance data %s", value, label)
 	}
 	r := &PerfData{}
 	r.Label = label
@@ -130,7 +220,7 @@ func New(label string, units UnitOfMeasurement, value string) *PerfData {
 	} else {
 		r.value = value
 	}
-	return r
+	return r, nil
 }
 
 // Set the warning range for the performance data record.
@@ -145,22 +235,72 @@ func (d *PerfData) SetCrit(r *PerfDataRange) {
 	d.bits = d.bits | PDAT_CRIT
 }
 
-// Set the performance data's minimal value
+// Set the performance data's minimal value. The program panics if the value
+// is invalid.
 func (d *PerfData) SetMin(min string) {
+	if err := d.CheckedSetMin(min); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Set the performance data's minimal value, returning an error if the value
+// is invalid.
+func (d *PerfData) CheckedSetMin(min string) error {
 	if !valueCheck.MatchString(min) {
-		panic("invalid value")
+		return fmt.Errorf("invalid minimal value '%s' for performance data %s", min, d.Label)
 	}
 	d.min = min
 	d.bits = d.bits | PDAT_MIN
+	return nil
 }
 
-// Set the performance data's maximal value.
+// Set the performance data's maximal value. The program panics if the value
+// is invalid.
 func (d *PerfData) SetMax(max string) {
+	if err := d.CheckedSetMax(max); err != nil {
+		panic(err.Error())
+	}
+}
+
+// Set the performance data's maximal value, returning an error if the value
+// is invalid.
+func (d *PerfData) CheckedSetMax(max string) error {
 	if !valueCheck.MatchString(max) {
-		panic("invalid value")
+		return fmt.Errorf("invalid maximal value '%s' for performance data %s", max, d.Label)
 	}
 	d.max = max
 	d.bits = d.bits | PDAT_MAX
+	return nil
+}
+
+// Merge the value and units of another performance data record into this
+// one, as well as its warning and critical ranges and its minimal and maximal
+// values if they are set.
+func (d *PerfData) Merge(other *PerfData) {
+	d.units = other.units
+	d.unitName = other.unitName
+	d.value = other.value
+	if other.bits&PDAT_WARN != 0 {
+		d.warn = other.warn
+	}
+	if other.bits&PDAT_CRIT != 0 {
+		d.crit = other.crit
+	}
+	if other.bits&PDAT_MIN != 0 {
+		d.min = other.min
+	}
+	if other.bits&PDAT_MAX != 0 {
+		d.max = other.max
+	}
+	d.bits = d.bits | other.bits
+}
+
+// Get the string representation of the record's unit of measurement.
+func (d *PerfData) unitString() string {
+	if d.unitName != "" {
+		return d.unitName
+	}
+	return d.units.String()
 }
 
 // Converts performance data to a string which may be read by the monitoring
@@ -176,7 +316,7 @@ func (d *PerfData) String() string {
 		sb.WriteString("'")
 	}
 	sb.WriteString("=")
-	sb.WriteString(fmt.Sprintf("%s%s;", d.value, d.units.String()))
+	sb.WriteString(fmt.Sprintf("%s%s;", d.value, d.unitString()))
 	if d.bits&PDAT_WARN != 0 {
 		sb.WriteString(d.warn.String())
 	}
@@ -195,3 +335,60 @@ func (d *PerfData) String() string {
 
 	return sb.String()
 }
+
+// Converts a value to a JSON number, or to nil if the value is infinite.
+func numberJSON(value string) *json.Number {
+	if value == "" || value == "~" {
+		return nil
+	}
+	n := json.Number(value)
+	return &n
+}
+
+// Converts the range to a JSON object with its start and end values (which
+// are omitted if infinite) and a flag indicating whether the range is
+// inverted.
+func (r *PerfDataRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Start  *json.Number `json:"start,omitempty"`
+		End    *json.Number `json:"end,omitempty"`
+		Inside bool         `json:"inside,omitempty"`
+	}{
+		Start:  numberJSON(r.start),
+		End:    numberJSON(r.end),
+		Inside: r.inside,
+	})
+}
+
+// Converts performance data to a JSON object. The value is null if it is
+// unknown, and elements that have not been set are omitted.
+func (d *PerfData) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Label string         `json:"label"`
+		Value *json.Number   `json:"value"`
+		Unit  string         `json:"unit,omitempty"`
+		Warn  *PerfDataRange `json:"warn,omitempty"`
+		Crit  *PerfDataRange `json:"crit,omitempty"`
+		Min   *json.Number   `json:"min,omitempty"`
+		Max   *json.Number   `json:"max,omitempty"`
+	}{
+		Label: d.Label,
+		Unit:  d.unitString(),
+	}
+	if d.value != "U" {
+		out.Value = numberJSON(d.value)
+	}
+	if d.bits&PDAT_WARN != 0 {
+		out.Warn = &d.warn
+	}
+	if d.bits&PDAT_CRIT != 0 {
+		out.Crit = &d.crit
+	}
+	if d.bits&PDAT_MIN != 0 {
+		out.Min = numberJSON(d.min)
+	}
+	if d.bits&PDAT_MAX != 0 {
+		out.Max = numberJSON(d.max)
+	}
+	return json.Marshal(out)
+}
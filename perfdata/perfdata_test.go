@@ -0,0 +1,80 @@
+package perfdata
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"10", ":10"},
+		{"10:", "10:"},
+		{"~:10", "~:10"},
+		{"10:20", "10:20"},
+		{"@10:20", "@10:20"},
+		{"-5:-1", "-5:-1"},
+		{"0.5:1.5", "0.5:1.5"},
+		{":10", ":10"},
+	}
+	for _, test := range tests {
+		r, err := ParseRange(test.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.spec, err)
+			continue
+		}
+		if got := r.String(); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseRangeErrors(t *testing.T) {
+	for _, spec := range []string{"", "@", "abc", "10:abc", "~", "20:10", "1:2:3", "10:~"} {
+		if _, err := ParseRange(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestRangeAlert(t *testing.T) {
+	tests := []struct {
+		spec  string
+		value float64
+		alert bool
+	}{
+		{"10", -1, true},
+		{"10", 0, false},
+		{"10", 10, false},
+		{"10", 11, true},
+		{"10:", 9.9, true},
+		{"10:", 10, false},
+		{"10:", 1e9, false},
+		{"~:10", -1e9, false},
+		{"~:10", 10.5, true},
+		{"10:20", 9, true},
+		{"10:20", 15, false},
+		{"10:20", 21, true},
+		{"@10:20", 9, false},
+		{"@10:20", 10, true},
+		{"@10:20", 20, true},
+		{"@10:20", 21, false},
+	}
+	for _, test := range tests {
+		r, err := ParseRange(test.spec)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", test.spec, err)
+		}
+		if got := r.Alert(test.value); got != test.alert {
+			t.Errorf("%q, %v: got %v, want %v", test.spec, test.value, got, test.alert)
+		}
+	}
+}
+
+func TestPDRAlert(t *testing.T) {
+	if r := PDRMax("10"); r.Alert(5) || !r.Alert(11) || !r.Alert(-1) {
+		t.Errorf("unexpected alert result for %s", r)
+	}
+	if r := PDRMinMax("~", "10").Inside(); !r.Alert(5) || r.Alert(11) {
+		t.Errorf("unexpected alert result for %s", r)
+	}
+}
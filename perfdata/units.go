@@ -0,0 +1,161 @@
+package perfdata
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Scale of a unit of measurement, expressed as a multiple of the smallest
+// unit that measures the same quantity.
+type unitScale struct {
+	base   UnitOfMeasurement
+	factor float64
+}
+
+// Scales of the units of measurement that can be converted. Byte units use
+// powers of 1024.
+var unitScales = map[UnitOfMeasurement]unitScale{
+	UOM_MICROSECONDS: {UOM_SECONDS, 1},
+	UOM_MILLISECONDS: {UOM_SECONDS, 1e3},
+	UOM_SECONDS:      {UOM_SECONDS, 1e6},
+	UOM_BYTES:        {UOM_BYTES, 1},
+	UOM_KILOBYTES:    {UOM_BYTES, 1 << 10},
+	UOM_MEGABYTES:    {UOM_BYTES, 1 << 20},
+	UOM_GIGABYTES:    {UOM_BYTES, 1 << 30},
+	UOM_TERABYTES:    {UOM_BYTES, 1 << 40},
+}
+
+// Units that may be selected when choosing a human-readable representation,
+// from the smallest to the largest.
+var humanUnits = map[UnitOfMeasurement][]UnitOfMeasurement{
+	UOM_SECONDS: {UOM_MICROSECONDS, UOM_MILLISECONDS, UOM_SECONDS},
+	UOM_BYTES:   {UOM_BYTES, UOM_KILOBYTES, UOM_MEGABYTES, UOM_GIGABYTES, UOM_TERABYTES},
+}
+
+// BaseUnit returns the unit in which values that use this unit should be
+// stored, i.e. seconds for durations and bytes for sizes. Units that cannot
+// be converted are their own base unit.
+func (u UnitOfMeasurement) BaseUnit() UnitOfMeasurement {
+	if scale, ok := unitScales[u]; ok {
+		return scale.base
+	}
+	return u
+}
+
+// ConvertibleTo checks whether values in this unit can be converted to
+// another unit.
+func (u UnitOfMeasurement) ConvertibleTo(other UnitOfMeasurement) bool {
+	if u == other {
+		return true
+	}
+	from, fok := unitScales[u]
+	to, tok := unitScales[other]
+	return fok && tok && from.base == to.base
+}
+
+// ConvertValue converts a value from a unit of measurement to another.
+// An error is returned if the units do not measure the same quantity.
+func ConvertValue(value float64, from, to UnitOfMeasurement) (float64, error) {
+	if from == to {
+		return value, nil
+	}
+	if !from.ConvertibleTo(to) {
+		return 0, fmt.Errorf("cannot convert from '%s' to '%s'", from, to)
+	}
+	return value * unitScales[from].factor / unitScales[to].factor, nil
+}
+
+// HumanReadable selects the largest unit in which the value's magnitude is
+// at least 1, and returns the value converted to that unit. Values in units
+// that cannot be converted, as well as zero, are returned unchanged.
+func HumanReadable(value float64, units UnitOfMeasurement) (float64, UnitOfMeasurement) {
+	candidates, ok := humanUnits[units.BaseUnit()]
+	if !ok || value == 0 {
+		return value, units
+	}
+	best := candidates[0]
+	for _, u := range candidates {
+		converted, _ := ConvertValue(value, units, u)
+		if math.Abs(converted) < 1 {
+			break
+		}
+		best = u
+	}
+	converted, _ := ConvertValue(value, units, best)
+	return converted, best
+}
+
+// FormatHuman formats a value using the unit selected by HumanReadable, with
+// `precision` decimals or PRECISION_EXACT, so that it can be included in a
+// plugin's status message (e.g. "1.5 GB" or "250 ms").
+func FormatHuman(value float64, units UnitOfMeasurement, precision int) string {
+	converted, u := HumanReadable(value, units)
+	if precision < 0 {
+		precision = -1
+	}
+	s := strconv.FormatFloat(converted, 'f', precision, 64)
+	if u == UOM_NONE || u == UOM_COUNTER {
+		return s
+	}
+	if u == UOM_PERCENT {
+		return s + "%"
+	}
+	return s + " " + u.String()
+}
+
+// Create performance data for a percentage, formatted using `precision`
+// decimals or PRECISION_EXACT. The record's minimal and maximal values are
+// set to 0 and 100, respectively.
+func NewPercent(label string, value float64, precision int) (*PerfData, error) {
+	d, err := NewFloat(label, UOM_PERCENT, value, precision)
+	if err != nil {
+		return nil, err
+	}
+	d.SetMin("0")
+	d.SetMax("100")
+	return d, nil
+}
+
+// Units returns the performance data's unit of measurement. UOM_NONE is
+// returned for records that were parsed with an unsupported unit.
+func (d *PerfData) Units() UnitOfMeasurement {
+	return d.units
+}
+
+// Convert a value stored as a string in a performance data record to another
+// unit. Empty strings, unknown values and infinite range boundaries are
+// returned unchanged.
+func convertString(value string, from, to UnitOfMeasurement) string {
+	if value == "" || value == "U" || value == "~" {
+		return value
+	}
+	f, _ := strconv.ParseFloat(value, 64)
+	f, _ = ConvertValue(f, from, to)
+	s, _ := FormatFloat(f, PRECISION_EXACT)
+	return s
+}
+
+// Convert the performance data record to another unit of measurement. The
+// value, ranges and minimal and maximal values are all converted. An error
+// is returned if the units do not measure the same quantity.
+func (d *PerfData) Convert(units UnitOfMeasurement) error {
+	if !d.units.ConvertibleTo(units) {
+		return fmt.Errorf("performance data %s: cannot convert from '%s' to '%s'", d.Label, d.units, units)
+	}
+	from := d.units
+	d.value = convertString(d.value, from, units)
+	d.min = convertString(d.min, from, units)
+	d.max = convertString(d.max, from, units)
+	for _, r := range []*PerfDataRange{&d.warn, &d.crit} {
+		r.start = convertString(r.start, from, units)
+		r.end = convertString(r.end, from, units)
+	}
+	d.units = units
+	return nil
+}
+
+// Convert the performance data record to its base unit.
+func (d *PerfData) ToBaseUnit() {
+	d.Convert(d.units.BaseUnit())
+}
@@ -0,0 +1,103 @@
+package perfdata
+
+import "testing"
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to UnitOfMeasurement
+		want     float64
+	}{
+		{1, UOM_SECONDS, UOM_MILLISECONDS, 1000},
+		{12, UOM_MILLISECONDS, UOM_SECONDS, 0.012},
+		{1500, UOM_MICROSECONDS, UOM_MILLISECONDS, 1.5},
+		{2, UOM_KILOBYTES, UOM_BYTES, 2048},
+		{1, UOM_TERABYTES, UOM_GIGABYTES, 1024},
+		{512, UOM_MEGABYTES, UOM_GIGABYTES, 0.5},
+		{42, UOM_PERCENT, UOM_PERCENT, 42},
+	}
+	for _, test := range tests {
+		got, err := ConvertValue(test.value, test.from, test.to)
+		if err != nil {
+			t.Errorf("%v%s -> %s: unexpected error %v", test.value, test.from, test.to, err)
+		} else if got != test.want {
+			t.Errorf("%v%s -> %s: got %v, want %v", test.value, test.from, test.to, got, test.want)
+		}
+	}
+	for _, pair := range [][2]UnitOfMeasurement{
+		{UOM_SECONDS, UOM_BYTES},
+		{UOM_PERCENT, UOM_NONE},
+		{UOM_COUNTER, UOM_BYTES},
+	} {
+		if _, err := ConvertValue(1, pair[0], pair[1]); err == nil {
+			t.Errorf("%s -> %s: expected an error", pair[0], pair[1])
+		}
+	}
+}
+
+func TestFormatHuman(t *testing.T) {
+	tests := []struct {
+		value     float64
+		units     UnitOfMeasurement
+		precision int
+		want      string
+	}{
+		{0.25, UOM_SECONDS, PRECISION_EXACT, "250 ms"},
+		{0.0000425, UOM_SECONDS, 1, "42.5 us"},
+		{90, UOM_SECONDS, 0, "90 s"},
+		{1536, UOM_MEGABYTES, 1, "1.5 GB"},
+		{100, UOM_BYTES, PRECISION_EXACT, "100 B"},
+		{3 << 40, UOM_BYTES, PRECISION_EXACT, "3 TB"},
+		{0, UOM_KILOBYTES, PRECISION_EXACT, "0 KB"},
+		{99.5, UOM_PERCENT, 1, "99.5%"},
+		{12, UOM_NONE, PRECISION_EXACT, "12"},
+	}
+	for _, test := range tests {
+		if got := FormatHuman(test.value, test.units, test.precision); got != test.want {
+			t.Errorf("%v%s: got %q, want %q", test.value, test.units, got, test.want)
+		}
+	}
+}
+
+func TestPerfDataConvert(t *testing.T) {
+	pd := New("rtt", UOM_MILLISECONDS, "250")
+	pd.SetWarn(PDRMax("500"))
+	pd.SetCrit(PDRMinMax("~", "1000").Inside())
+	pd.SetMin("0")
+	pd.ToBaseUnit()
+	if got, want := pd.String(), "rtt=0.25s;:0.5;@~:1;0;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if pd.Units() != UOM_SECONDS {
+		t.Errorf("got units %s, want s", pd.Units())
+	}
+	if err := pd.Convert(UOM_BYTES); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	pd = New("unknown", UOM_KILOBYTES, "")
+	pd.ToBaseUnit()
+	if got, want := pd.String(), "unknown=UB;;;;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewPercent(t *testing.T) {
+	pd, err := NewPercent("usage", 12.5, 1)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := pd.String(), "usage=12.5%;;;0;100"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseExtraUnits(t *testing.T) {
+	records, err := Parse("a=12ms;; b=3us")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if records[0].Units() != UOM_MILLISECONDS || records[1].Units() != UOM_MICROSECONDS {
+		t.Errorf("got units %s and %s", records[0].Units(), records[1].Units())
+	}
+}
@@ -0,0 +1,135 @@
+package perfdata
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Precision that may be passed to the floating point helpers in order to use
+// the smallest number of decimals that represents the value exactly.
+const PRECISION_EXACT = -1
+
+// Formats a floating point value so that it can be used in performance data.
+// The value is never written using exponent notation; `precision` is the
+// number of decimals to use, or PRECISION_EXACT. An error is returned if the
+// value is infinite or not a number.
+func FormatFloat(value float64, precision int) (string, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", fmt.Errorf("cannot use %v as a performance data value", value)
+	}
+	if precision < 0 {
+		precision = -1
+	}
+	return strconv.FormatFloat(value, 'f', precision, 64), nil
+}
+
+// Formats an integer value so that it can be used in performance data.
+func FormatInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+// Formats a duration as a number of seconds so that it can be used in
+// performance data, using `precision` decimals or PRECISION_EXACT.
+func FormatDuration(value time.Duration, precision int) string {
+	if precision < 0 {
+		precision = -1
+	}
+	return strconv.FormatFloat(value.Seconds(), 'f', precision, 64)
+}
+
+// Create performance data using the specified label, units and floating
+// point value, which is formatted using `precision` decimals or
+// PRECISION_EXACT. An error is returned if the value is infinite or not a
+// number.
+func NewFloat(label string, units UnitOfMeasurement, value float64, precision int) (*PerfData, error) {
+	s, err := FormatFloat(value, precision)
+	if err != nil {
+		return nil, fmt.Errorf("performance data %s: %w", label, err)
+	}
+	return CheckedNew(label, units, s)
+}
+
+// Create performance data using the specified label, units and integer value.
+func NewInt(label string, units UnitOfMeasurement, value int64) *PerfData {
+	return New(label, units, FormatInt(value))
+}
+
+// Create performance data using the specified label and a duration, which is
+// expressed in seconds using `precision` decimals or PRECISION_EXACT.
+func NewDuration(label string, value time.Duration, precision int) *PerfData {
+	return New(label, UOM_SECONDS, FormatDuration(value, precision))
+}
+
+// Set the performance data's minimal value from a floating point value,
+// formatted using `precision` decimals or PRECISION_EXACT.
+func (d *PerfData) SetMinFloat(min float64, precision int) error {
+	s, err := FormatFloat(min, precision)
+	if err != nil {
+		return fmt.Errorf("performance data %s: %w", d.Label, err)
+	}
+	return d.CheckedSetMin(s)
+}
+
+// Set the performance data's maximal value from a floating point value,
+// formatted using `precision` decimals or PRECISION_EXACT.
+func (d *PerfData) SetMaxFloat(max float64, precision int) error {
+	s, err := FormatFloat(max, precision)
+	if err != nil {
+		return fmt.Errorf("performance data %s: %w", d.Label, err)
+	}
+	return d.CheckedSetMax(s)
+}
+
+// Set the performance data's minimal value from an integer value.
+func (d *PerfData) SetMinInt(min int64) {
+	d.SetMin(FormatInt(min))
+}
+
+// Set the performance data's maximal value from an integer value.
+func (d *PerfData) SetMaxInt(max int64) {
+	d.SetMax(FormatInt(max))
+}
+
+// Creates a performance data range from -inf to 0 and from the specified
+// floating point value to +inf, formatted using `precision` decimals or
+// PRECISION_EXACT.
+func PDRMaxFloat(max float64, precision int) (*PerfDataRange, error) {
+	s, err := FormatFloat(max, precision)
+	if err != nil {
+		return nil, err
+	}
+	return CheckedPDRMax(s)
+}
+
+// Creates a performance data range from -inf to the specified minimal value
+// and from the specified maximal value to +inf, both formatted using
+// `precision` decimals or PRECISION_EXACT. A minimal value of -Inf makes the
+// range start at -inf.
+func PDRMinMaxFloat(min, max float64, precision int) (*PerfDataRange, error) {
+	sMin := "~"
+	if !math.IsInf(min, -1) {
+		var err error
+		if sMin, err = FormatFloat(min, precision); err != nil {
+			return nil, err
+		}
+	}
+	sMax, err := FormatFloat(max, precision)
+	if err != nil {
+		return nil, err
+	}
+	return CheckedPDRMinMax(sMin, sMax)
+}
+
+// Creates a performance data range from -inf to 0 and from the specified
+// integer value to +inf.
+func PDRMaxInt(max int64) *PerfDataRange {
+	return PDRMax(FormatInt(max))
+}
+
+// Creates a performance data range from -inf to the specified minimal value
+// and from the specified maximal value to +inf.
+func PDRMinMaxInt(min, max int64) *PerfDataRange {
+	return PDRMinMax(FormatInt(min), FormatInt(max))
+}
@@ -0,0 +1,100 @@
+package perfdata
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		value     float64
+		precision int
+		want      string
+	}{
+		{0, PRECISION_EXACT, "0"},
+		{1.5, PRECISION_EXACT, "1.5"},
+		{1e21, PRECISION_EXACT, "1000000000000000000000"},
+		{1e-7, PRECISION_EXACT, "0.0000001"},
+		{-2.25, 1, "-2.2"},
+		{3.14159, 2, "3.14"},
+		{42, 3, "42.000"},
+	}
+	for _, test := range tests {
+		got, err := FormatFloat(test.value, test.precision)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%v/%d: got %q, want %q", test.value, test.precision, got, test.want)
+		}
+		if !valueCheck.MatchString(got) {
+			t.Errorf("%v/%d: %q is not a valid value", test.value, test.precision, got)
+		}
+	}
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := FormatFloat(value, PRECISION_EXACT); err == nil {
+			t.Errorf("%v: expected an error", value)
+		}
+	}
+}
+
+func TestTypedConstructors(t *testing.T) {
+	pd, err := NewFloat("load", UOM_NONE, 0.125, PRECISION_EXACT)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := pd.SetMinFloat(0, 1); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := pd.SetMaxFloat(math.Inf(1), 1); err == nil {
+		t.Errorf("infinite maximum: expected an error")
+	}
+	r, err := PDRMinMaxFloat(math.Inf(-1), 2.5, PRECISION_EXACT)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	pd.SetWarn(r)
+	pd.SetCrit(PDRMaxInt(4))
+	if got, want := pd.String(), "load=0.125;~:2.5;:4;0.0;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	pd = NewInt("count", UOM_COUNTER, -12)
+	pd.SetMinInt(-20)
+	pd.SetMaxInt(20)
+	if got, want := pd.String(), "count=-12c;;;-20;20"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	pd = NewDuration("rtt", 1500*time.Microsecond, PRECISION_EXACT)
+	if got, want := pd.String(), "rtt=0.0015s;;;;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := NewFloat("bad", UOM_NONE, math.NaN(), 2); err == nil {
+		t.Errorf("NaN value: expected an error")
+	}
+}
+
+func TestCheckedVariants(t *testing.T) {
+	if _, err := CheckedNew("x", UOM_NONE, "1e5"); err == nil {
+		t.Errorf("CheckedNew: expected an error")
+	}
+	if _, err := CheckedPDRMax("abc"); err == nil {
+		t.Errorf("CheckedPDRMax: expected an error")
+	}
+	if _, err := CheckedPDRMinMax("x", "1"); err == nil {
+		t.Errorf("CheckedPDRMinMax: expected an error")
+	}
+	pd := New("x", UOM_NONE, "1")
+	if err := pd.CheckedSetMin("-"); err == nil {
+		t.Errorf("CheckedSetMin: expected an error")
+	}
+	if err := pd.CheckedSetMax(""); err == nil {
+		t.Errorf("CheckedSetMax: expected an error")
+	}
+	if got, want := pd.String(), "x=1;;;;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
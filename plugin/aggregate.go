@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy determines how the plugin's overall status is computed from the
+// statuses of its sub-results.
+type Policy int
+
+// Aggregation policies.
+const (
+	// The overall status is the worst of the sub-results' statuses.
+	POLICY_WORST Policy = iota
+	// The overall status is the best of the sub-results' statuses.
+	POLICY_BEST
+	// The overall status is the most frequent of the sub-results' statuses.
+	// Ties are resolved by selecting the worst status.
+	POLICY_MAJORITY
+)
+
+// SubResult represents the outcome of one of the plugin's sub-checks.
+type SubResult struct {
+	Status  Status
+	Message string
+}
+
+// Severity of the various statuses, from the least to the most severe.
+var severity = [...]int{
+	OK:       0,
+	WARNING:  1,
+	UNKNOWN:  2,
+	CRITICAL: 3,
+}
+
+// Worse returns true if the status is more severe than `other`. Critical
+// states are the most severe, followed by unknown and warning states.
+func (s Status) Worse(other Status) bool {
+	return severity[s] > severity[other]
+}
+
+// Aggregate computes the overall status from a list of sub-results, using
+// the specified policy. It returns UNKNOWN if the list is empty.
+func Aggregate(policy Policy, results []SubResult) Status {
+	if len(results) == 0 {
+		return UNKNOWN
+	}
+	status := results[0].Status
+	switch policy {
+	case POLICY_WORST:
+		for _, r := range results[1:] {
+			if r.Status.Worse(status) {
+				status = r.Status
+			}
+		}
+	case POLICY_BEST:
+		for _, r := range results[1:] {
+			if status.Worse(r.Status) {
+				status = r.Status
+			}
+		}
+	case POLICY_MAJORITY:
+		counts := make(map[Status]int)
+		for _, r := range results {
+			counts[r.Status]++
+		}
+		for s, n := range counts {
+			if n > counts[status] || (n == counts[status] && s.Worse(status)) {
+				status = s
+			}
+		}
+	default:
+		panic(fmt.Sprintf("invalid aggregation policy %d", policy))
+	}
+	return status
+}
+
+// Summarize generates a summary line from the messages of the sub-results
+// that have the specified status.
+func Summarize(status Status, results []SubResult) string {
+	var messages []string
+	for _, r := range results {
+		if r.Status == status {
+			messages = append(messages, r.Message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// String generates the long output line that describes a sub-result.
+func (r SubResult) String() string {
+	return fmt.Sprintf("[%s] %s", r.Status, r.Message)
+}
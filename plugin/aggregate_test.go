@@ -0,0 +1,55 @@
+package plugin
+
+import "testing"
+
+func makeResults(statuses ...Status) []SubResult {
+	results := make([]SubResult, len(statuses))
+	for i, s := range statuses {
+		results[i] = SubResult{Status: s, Message: s.String()}
+	}
+	return results
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		statuses []Status
+		want     Status
+	}{
+		{POLICY_WORST, []Status{}, UNKNOWN},
+		{POLICY_WORST, []Status{OK, WARNING, OK}, WARNING},
+		{POLICY_WORST, []Status{OK, UNKNOWN, WARNING}, UNKNOWN},
+		{POLICY_WORST, []Status{CRITICAL, UNKNOWN, OK}, CRITICAL},
+		{POLICY_BEST, []Status{CRITICAL, WARNING, UNKNOWN}, WARNING},
+		{POLICY_BEST, []Status{CRITICAL, OK}, OK},
+		{POLICY_MAJORITY, []Status{OK, CRITICAL, OK}, OK},
+		{POLICY_MAJORITY, []Status{OK, CRITICAL, CRITICAL, WARNING}, CRITICAL},
+		{POLICY_MAJORITY, []Status{OK, WARNING}, WARNING},
+	}
+	for _, test := range tests {
+		if got := Aggregate(test.policy, makeResults(test.statuses...)); got != test.want {
+			t.Errorf("%d %v: got %v, want %v", test.policy, test.statuses, got, test.want)
+		}
+	}
+}
+
+func TestPluginSubResults(t *testing.T) {
+	p := New("Test")
+	p.AddResult(OK, "first is fine")
+	p.AddResult(WARNING, "second is odd")
+	p.AddResult(WARNING, "third is odd")
+	p.AddLine("extra")
+	want := "Test WARNING: second is odd; third is odd\n" +
+		"[OK] first is fine\n[WARNING] second is odd\n[WARNING] third is odd\nextra"
+	if got := p.Result().String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	p.SetPolicy(POLICY_BEST)
+	if r := p.Result(); r.Status != OK || r.Message != "first is fine" {
+		t.Errorf("unexpected result %v", r)
+	}
+	p.SetState(UNKNOWN, "overridden")
+	if r := p.Result(); r.Status != UNKNOWN || r.Message != "overridden" || len(r.Lines) != 4 {
+		t.Errorf("unexpected result %v", r)
+	}
+}
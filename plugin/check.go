@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Version is the version of the plugins, which is displayed when the -V flag
+// is used. It may be set at build time using the linker's -X flag.
+var Version = "development"
+
+// Check is the interface implemented by monitoring checks in order to be run
+// by the plugin framework.
+type Check interface {
+	// DeclareFlags declares the check's own command line flags.
+	DeclareFlags(flags *Flags)
+	// CheckFlags validates the flags' values once the command line has been
+	// parsed. If the values are invalid, it must set the plugin's state
+	// accordingly and return false.
+	CheckFlags(p *Plugin) bool
+	// Run performs the check and updates the plugin's state.
+	Run(p *Plugin)
+}
+
+// Standard options that are supported by all checks.
+type standardOptions struct {
+	help         bool
+	version      bool
+	verbosity    int
+	timeout      string
+	outputFormat string
+	metricsFmt   string
+	metricsOut   string
+	metricsHost  string
+	stateDir     string
+	icinga       IcingaConfig
+	nagiosSpool  string
+	nagiosCmd    string
+	nagiosHost   string
+	nagiosSvc    string
+}
+
+// Declare the standard options' flags.
+func (opts *standardOptions) declareFlags(flags *Flags) {
+	flags.BoolVarP(&opts.help, 'h', "help", false, "Display usage information.")
+	flags.BoolVarP(&opts.version, 'V', "version", false, "Display version information.")
+	flags.CountVarP(&opts.verbosity, 'v', "verbose",
+		"Increase verbosity; may be repeated (-vv, -vvv).")
+	flags.StringVarP(&opts.timeout, 't', "timeout", "10",
+		"Execution timeout in seconds, optionally followed by ':' and the state to use "+
+			"when it expires (e.g. 10:critical).")
+	flags.StringVar(&opts.outputFormat, "output-format", "",
+		"Output format (text or json). Overrides the "+OutputFormatEnv+
+			" environment variable.")
+	flags.StringVar(&opts.metricsOut, "metrics-output", "",
+		"Export performance data to a file, or to a socket using a tcp://, udp:// or "+
+			"unix:// address.")
+	flags.StringVar(&opts.metricsFmt, "metrics-format", "graphite",
+		"Format of the exported performance data (graphite, influxdb or openmetrics).")
+	flags.StringVar(&opts.metricsHost, "metrics-host", "",
+		"Host name used in the exported performance data. Defaults to the local host name.")
+	flags.StringVar(&opts.stateDir, "state-dir", "",
+		"Directory in which the check's state is stored. Overrides the "+StateDirEnv+
+			" environment variable.")
+	flags.StringVar(&opts.icinga.URL, "icinga-url", "",
+		"Submit the result to the Icinga 2 API at this URL instead of writing it to the "+
+			"standard output.")
+	flags.StringVar(&opts.icinga.Host, "icinga-host", "",
+		"Name of the Icinga host the result is submitted for.")
+	flags.StringVar(&opts.icinga.Service, "icinga-service", "",
+		"Name of the Icinga service the result is submitted for. If it is not set, a host "+
+			"check result is submitted.")
+	flags.StringVar(&opts.icinga.Username, "icinga-user", "",
+		"User name for the Icinga 2 API. The password is read from the "+IcingaPasswordEnv+
+			" environment variable.")
+	flags.StringVar(&opts.icinga.CertFile, "icinga-cert", "",
+		"Client certificate used to authenticate with the Icinga 2 API.")
+	flags.StringVar(&opts.icinga.KeyFile, "icinga-key", "",
+		"Private key of the client certificate used with the Icinga 2 API.")
+	flags.StringVar(&opts.icinga.CAFile, "icinga-ca", "",
+		"CA bundle used to verify the Icinga 2 API's certificate.")
+	flags.StringVar(&opts.nagiosSpool, "nagios-spool", "",
+		"Write the result into this Nagios check result directory instead of writing it "+
+			"to the standard output.")
+	flags.StringVar(&opts.nagiosCmd, "nagios-command-file", "",
+		"Submit the result through this Nagios external command file instead of writing "+
+			"it to the standard output.")
+	flags.StringVar(&opts.nagiosHost, "nagios-host", "",
+		"Name of the Nagios host the result is submitted for.")
+	flags.StringVar(&opts.nagiosSvc, "nagios-service", "",
+		"Name of the Nagios service the result is submitted for. If it is not set, a host "+
+			"check result is submitted.")
+}
+
+// Apply the standard options to the plugin. The arguments identify the
+// check's state. Returns false and sets the plugin's state if the options
+// are invalid.
+func (opts *standardOptions) apply(p *Plugin, args []string) bool {
+	p.SetVerbosity(opts.verbosity)
+	stateDir := opts.stateDir
+	if stateDir == "" {
+		stateDir = defaultStateDir()
+	}
+	p.SetStateStore(NewStateStore(stateDir), args)
+	if opts.icinga.URL != "" {
+		config := opts.icinga
+		config.Password = os.Getenv(IcingaPasswordEnv)
+		config.CheckSource, _ = os.Hostname()
+		sink, err := NewIcingaSink(config)
+		if err != nil {
+			p.SetState(UNKNOWN, err.Error())
+			return false
+		}
+		p.SetSink(sink)
+	}
+	if opts.nagiosSpool != "" || opts.nagiosCmd != "" {
+		if opts.icinga.URL != "" || (opts.nagiosSpool != "" && opts.nagiosCmd != "") {
+			p.SetState(UNKNOWN, "only one passive result destination may be specified")
+			return false
+		}
+		if opts.nagiosHost == "" {
+			p.SetState(UNKNOWN, "no Nagios host name specified")
+			return false
+		}
+		if opts.nagiosSpool != "" {
+			p.SetSink(NewCheckResultSink(opts.nagiosSpool, opts.nagiosHost, opts.nagiosSvc))
+		} else {
+			p.SetSink(NewCommandFileSink(opts.nagiosCmd, opts.nagiosHost, opts.nagiosSvc))
+		}
+	}
+	if opts.outputFormat != "" {
+		format, err := ParseOutputFormat(opts.outputFormat)
+		if err != nil {
+			p.SetState(UNKNOWN, err.Error())
+			return false
+		}
+		p.SetOutputFormat(format)
+	}
+	if opts.timeout != "" {
+		timeout, state, err := ParseTimeout(opts.timeout)
+		if err != nil {
+			p.SetState(UNKNOWN, err.Error())
+			return false
+		}
+		p.SetTimeout(timeout, state)
+	}
+	if opts.metricsOut != "" {
+		format, err := perfdata.ParseExportFormat(opts.metricsFmt)
+		if err != nil {
+			p.SetState(UNKNOWN, err.Error())
+			return false
+		}
+		host := opts.metricsHost
+		if host == "" {
+			host, _ = os.Hostname()
+		}
+		p.SetMetricsExport(format, opts.metricsOut, host)
+	}
+	return true
+}
+
+// Main runs a check as a standalone monitoring plugin named `name`. It parses
+// the command line, including the standard options (help, version,
+// verbosity, timeout, output format and metrics export), then validates the check's flags
+// and runs it. Once the check is complete, or if it panics, the plugin's
+// output is generated and the program exits.
+func Main(name string, check Check) {
+	p := New(name)
+	defer func() {
+		if r := recover(); r != nil {
+			p.SetState(UNKNOWN, "Internal error")
+			p.AddLine("Error info: %v", r)
+		}
+		p.Done()
+	}()
+
+	var opts standardOptions
+	flags := &Flags{}
+	opts.declareFlags(flags)
+	check.DeclareFlags(flags)
+	if err := flags.parse(os.Args[1:]); err != nil {
+		p.SetState(UNKNOWN, err.Error())
+		return
+	}
+	if opts.help {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		flags.printDefaults(os.Stderr)
+		os.Exit(0)
+	}
+	if opts.version {
+		fmt.Printf("%s %s\n", name, Version)
+		os.Exit(0)
+	}
+
+	if opts.apply(p, os.Args[1:]) && check.CheckFlags(p) {
+		check.Run(p)
+	}
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStandardOptions(t *testing.T) {
+	p := New("Test")
+	opts := standardOptions{verbosity: 5, outputFormat: "json"}
+	if !opts.apply(p, nil) {
+		t.Fatalf("unexpected failure: %v", p.Result())
+	}
+	if p.Verbosity() != 3 || p.format != OUTPUT_JSON {
+		t.Errorf("unexpected verbosity %d or format %v", p.Verbosity(), p.format)
+	}
+	if _, ok := p.Context().Deadline(); ok {
+		t.Errorf("unexpected deadline")
+	}
+
+	for _, opts := range []standardOptions{
+		{outputFormat: "xml"},
+		{timeout: "x"},
+		{metricsOut: "metrics.txt", metricsFmt: "statsd"},
+		{nagiosSpool: "/var/spool", nagiosCmd: "/var/cmd", nagiosHost: "www"},
+		{nagiosCmd: "/var/cmd"},
+	} {
+		p := New("Test")
+		if opts.apply(p, nil) {
+			t.Errorf("%v: expected a failure", opts)
+		} else if r := p.Result(); r.Status != UNKNOWN {
+			t.Errorf("%v: unexpected status %v", opts, r.Status)
+		}
+	}
+}
+
+func TestFlagsUsage(t *testing.T) {
+	var (
+		b bool
+		i int
+		s string
+	)
+	flags := &Flags{}
+	flags.BoolVar(&b, "test-bool", true, "A boolean flag.")
+	flags.CountVarP(&i, 'c', "test-count", "")
+	flags.StringVarP(&s, 'S', "test-string", "value", "A string flag with a description that "+
+		"is long enough to be wrapped.")
+	var buf bytes.Buffer
+	flags.printDefaults(&buf)
+	want := "  --test-bool\n    A boolean flag.\n" +
+		"  -c, --test-count\n" +
+		"  -S, --test-string string (default: \"value\")\n" +
+		"    A string flag with a description that is long enough to be wrapped.\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
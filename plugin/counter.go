@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"strconv"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Suffix added to a counter's label in order to generate the label of the
+// corresponding rate.
+const RateSuffix = "_rate"
+
+// Number of decimals used for rates in the performance data.
+const ratePrecision = 3
+
+// Name of the state section in which counter samples are stored.
+const counterStateSection = "counters"
+
+// A counter's value at a given time, as stored in the check's state.
+type counterSample struct {
+	Value uint64 `json:"value"`
+	Time  int64  `json:"time"`
+}
+
+// CounterRate computes the per-second rate of a monotonically increasing
+// counter from its previous and current values and the time that elapsed
+// between both samples. If the current value is lower than the previous one
+// and `wrap` is not zero, the counter is assumed to have wrapped around at
+// that value (e.g. 1<<32 for a 32-bit counter); otherwise the counter is
+// assumed to have been reset. The second value is false if no rate can be
+// computed, i.e. if the counter has been reset or if no time has elapsed.
+func CounterRate(previous, current uint64, elapsed time.Duration, wrap uint64) (float64, bool) {
+	if elapsed <= 0 {
+		return 0, false
+	}
+	var delta uint64
+	if current >= previous {
+		delta = current - previous
+	} else if wrap != 0 && previous < wrap {
+		delta = wrap - previous + current
+	} else {
+		return 0, false
+	}
+	return float64(delta) / elapsed.Seconds(), true
+}
+
+// Counters computes rates from counters, using the values that were saved in
+// the check's state during its previous run. It must be closed once all
+// counters have been added in order to save the new values.
+type Counters struct {
+	plugin   *Plugin
+	state    *StateFile
+	previous map[string]counterSample
+	current  map[string]counterSample
+	now      func() time.Time
+}
+
+// Counters opens the state in which the check's counters are stored and
+// returns the helper that can be used to add them to the performance data.
+func (p *Plugin) Counters() (*Counters, error) {
+	state, err := p.OpenNamedState(counterStateSection)
+	if err != nil {
+		return nil, err
+	}
+	c := &Counters{
+		plugin:  p,
+		state:   state,
+		current: make(map[string]counterSample),
+		now:     time.Now,
+	}
+	if _, err := state.Load(&c.previous); err != nil {
+		state.Close()
+		return nil, err
+	}
+	for label, sample := range c.previous {
+		c.current[label] = sample
+	}
+	return c, nil
+}
+
+// Add adds a counter's raw value to the performance data, as well as its
+// rate, labelled with the counter's label followed by RateSuffix. The rate
+// is computed from the previous run's value (see CounterRate for the meaning
+// of `wrap`); if it cannot be computed, its value is unknown. The rate is
+// returned, along with a flag indicating whether it could be computed.
+func (c *Counters) Add(label string, value uint64, wrap uint64) (float64, bool) {
+	sample := counterSample{Value: value, Time: c.now().UnixNano()}
+	c.current[label] = sample
+	c.plugin.AddPerfData(perfdata.New(label, perfdata.UOM_COUNTER, strconv.FormatUint(value, 10)))
+
+	previous, found := c.previous[label]
+	var rate float64
+	ok := false
+	if found {
+		elapsed := time.Duration(sample.Time - previous.Time)
+		rate, ok = CounterRate(previous.Value, value, elapsed, wrap)
+	}
+	if ok {
+		pd, _ := perfdata.NewFloat(label+RateSuffix, perfdata.UOM_NONE, rate, ratePrecision)
+		c.plugin.AddPerfData(pd)
+	} else {
+		c.plugin.AddPerfData(perfdata.New(label+RateSuffix, perfdata.UOM_NONE, ""))
+	}
+	return rate, ok
+}
+
+// Close saves the values of the counters that have been added, keeping those
+// of the counters that have not been updated, and releases the lock on the
+// state.
+func (c *Counters) Close() error {
+	err := c.state.Save(c.current)
+	if cerr := c.state.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
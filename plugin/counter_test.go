@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterRate(t *testing.T) {
+	tests := []struct {
+		previous, current uint64
+		elapsed           time.Duration
+		wrap              uint64
+		rate              float64
+		ok                bool
+	}{
+		{100, 700, time.Minute, 0, 10, true},
+		{100, 100, time.Second, 0, 0, true},
+		{math.MaxUint32 - 9, 10, 2 * time.Second, 1 << 32, 10, true},
+		{500, 10, time.Second, 0, 0, false},
+		{1 << 40, 10, time.Second, 1 << 32, 0, false},
+		{100, 200, 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		rate, ok := CounterRate(test.previous, test.current, test.elapsed, test.wrap)
+		if rate != test.rate || ok != test.ok {
+			t.Errorf("%d -> %d in %v (wrap %d): got %v %v, want %v %v", test.previous, test.current,
+				test.elapsed, test.wrap, rate, ok, test.rate, test.ok)
+		}
+	}
+}
+
+// Run a plugin that adds counters at the specified time, and return the
+// text representation of its performance data.
+func runCounters(t *testing.T, store *StateStore, now time.Time, values map[string]uint64) string {
+	p := New("Test")
+	p.SetStateStore(store, []string{"-H", "host"})
+	counters, err := p.Counters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counters.now = func() time.Time { return now }
+	for _, label := range []string{"in", "out"} {
+		if value, ok := values[label]; ok {
+			counters.Add(label, value, 0)
+		}
+	}
+	if err := counters.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := p.Result()
+	r.Name, r.Message, r.Status = "", "", OK
+	return r.String()
+}
+
+func TestCounters(t *testing.T) {
+	store := NewStateStore(t.TempDir())
+	start := time.Unix(1600000000, 0)
+
+	got := runCounters(t, store, start, map[string]uint64{"in": 1000, "out": 50})
+	if want := " OK:  | in=1000c;;;;, in_rate=U;;;;, out=50c;;;;, out_rate=U;;;;"; got != want {
+		t.Errorf("first run: got %q, want %q", got, want)
+	}
+
+	got = runCounters(t, store, start.Add(10*time.Second), map[string]uint64{"in": 1255})
+	if want := " OK:  | in=1255c;;;;, in_rate=25.500;;;;"; got != want {
+		t.Errorf("second run: got %q, want %q", got, want)
+	}
+
+	got = runCounters(t, store, start.Add(20*time.Second), map[string]uint64{"in": 5, "out": 150})
+	if want := " OK:  | in=5c;;;;, in_rate=U;;;;, out=150c;;;;, out_rate=5.000;;;;"; got != want {
+		t.Errorf("third run: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,267 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A command line flag declared by a check.
+type flagOption struct {
+	short       rune
+	long        string
+	description string
+	pv          interface{}
+	value       interface{}
+	count       bool
+}
+
+// Flags is used by checks to declare their command line flags. Each flag has
+// an optional short name, a long name, a default value and a description.
+type Flags struct {
+	options []flagOption
+}
+
+// Add a flag to the list.
+func (f *Flags) add(pv interface{}, short rune, long string, value interface{}, description string) {
+	f.options = append(f.options, flagOption{
+		short:       short,
+		long:        long,
+		description: description,
+		pv:          pv,
+		value:       value,
+	})
+}
+
+// BoolVar declares a boolean flag that only has a long name.
+func (f *Flags) BoolVar(pv *bool, long string, value bool, description string) {
+	f.add(pv, 0, long, value, description)
+}
+
+// BoolVarP declares a boolean flag with both a short and a long name.
+func (f *Flags) BoolVarP(pv *bool, short rune, long string, value bool, description string) {
+	f.add(pv, short, long, value, description)
+}
+
+// IntVar declares an integer flag that only has a long name.
+func (f *Flags) IntVar(pv *int, long string, value int, description string) {
+	f.add(pv, 0, long, value, description)
+}
+
+// IntVarP declares an integer flag with both a short and a long name.
+func (f *Flags) IntVarP(pv *int, short rune, long string, value int, description string) {
+	f.add(pv, short, long, value, description)
+}
+
+// CountVarP declares an integer flag with both a short and a long name,
+// which does not take a value and is incremented each time it is used; for
+// example, -vv and -v --verbose both set the verbosity to 2.
+func (f *Flags) CountVarP(pv *int, short rune, long string, description string) {
+	f.add(pv, short, long, 0, description)
+	f.options[len(f.options)-1].count = true
+}
+
+// StringVar declares a string flag that only has a long name.
+func (f *Flags) StringVar(pv *string, long string, value string, description string) {
+	f.add(pv, 0, long, value, description)
+}
+
+// StringVarP declares a string flag with both a short and a long name.
+func (f *Flags) StringVarP(pv *string, short rune, long string, value string, description string) {
+	f.add(pv, short, long, value, description)
+}
+
+// Set all flags to their default values.
+func (f *Flags) setDefaults() {
+	for _, o := range f.options {
+		switch pv := o.pv.(type) {
+		case *bool:
+			*pv = o.value.(bool)
+		case *int:
+			*pv = o.value.(int)
+		case *string:
+			*pv = o.value.(string)
+		}
+	}
+}
+
+// Find a flag using its long name.
+func (f *Flags) findLong(name string) *flagOption {
+	for i := range f.options {
+		if f.options[i].long == name {
+			return &f.options[i]
+		}
+	}
+	return nil
+}
+
+// Find a flag using its short name.
+func (f *Flags) findShort(name rune) *flagOption {
+	for i := range f.options {
+		if f.options[i].short == name {
+			return &f.options[i]
+		}
+	}
+	return nil
+}
+
+// Check whether a flag requires a value, i.e. whether it is neither a
+// boolean flag nor a counter.
+func (o *flagOption) needsValue() bool {
+	_, ok := o.pv.(*bool)
+	return !ok && !o.count
+}
+
+// Set a flag's value from its string representation.
+func (o *flagOption) set(value string) error {
+	switch pv := o.pv.(type) {
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for flag --%s", value, o.long)
+		}
+		*pv = b
+	case *int:
+		if o.count {
+			*pv++
+			return nil
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for flag --%s", value, o.long)
+		}
+		*pv = i
+	case *string:
+		*pv = value
+	}
+	return nil
+}
+
+// Parse a list of arguments, which does not include the program's name. Long
+// flags may be followed by '=' and their value or by a separate argument,
+// and short flags may be grouped or followed by their value. Arguments that
+// are not flags are rejected. The same parser is used whether the check runs
+// as a standalone plugin or in-process.
+func (f *Flags) parse(args []string) error {
+	f.setDefaults()
+	_, err := f.scan(args, func(o *flagOption, value string) error {
+		return o.set(value)
+	})
+	return err
+}
+
+// Go through a list of arguments, calling a function with each flag that is
+// found and its value. For each argument, the offset at which the value of
+// a flag starts is returned, or -1 if the argument does not contain a value.
+func (f *Flags) scan(args []string, found func(o *flagOption, value string) error) ([]int, error) {
+	offsets := make([]int, len(args))
+	for i := range offsets {
+		offsets[i] = -1
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				return nil, fmt.Errorf("unexpected argument '%s'", args[i+1])
+			}
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, value := arg[2:], ""
+			eq := strings.IndexByte(name, '=')
+			if eq != -1 {
+				name, value = name[:eq], name[eq+1:]
+				offsets[i] = eq + 3
+			}
+			o := f.findLong(name)
+			if o == nil {
+				return nil, fmt.Errorf("unknown flag --%s", name)
+			}
+			if o.count && eq != -1 {
+				return nil, fmt.Errorf("flag --%s does not take a value", name)
+			}
+			if eq == -1 {
+				if !o.needsValue() {
+					value = "true"
+				} else if i+1 < len(args) {
+					i++
+					value = args[i]
+					offsets[i] = 0
+				} else {
+					return nil, fmt.Errorf("missing value for flag --%s", name)
+				}
+			}
+			if err := found(o, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return nil, fmt.Errorf("unexpected argument '%s'", arg)
+		}
+		pos := 1
+		for _, short := range arg[1:] {
+			pos += utf8.RuneLen(short)
+			o := f.findShort(short)
+			if o == nil {
+				return nil, fmt.Errorf("unknown flag -%c", short)
+			}
+			if !o.needsValue() {
+				if err := found(o, "true"); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			value := arg[pos:]
+			if value != "" {
+				offsets[i] = pos
+			} else {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("missing value for flag -%c", short)
+				}
+				i++
+				value = args[i]
+				offsets[i] = 0
+			}
+			if err := found(o, value); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return offsets, nil
+}
+
+// Write the description of all flags, along with their default values.
+func (f *Flags) printDefaults(w io.Writer) {
+	for _, o := range f.options {
+		var name string
+		if o.short != 0 {
+			name = fmt.Sprintf("-%c, --%s", o.short, o.long)
+		} else {
+			name = "--" + o.long
+		}
+		switch v := o.value.(type) {
+		case int:
+			if !o.count {
+				name += fmt.Sprintf(" int (default: %d)", v)
+			}
+		case string:
+			name += fmt.Sprintf(" string (default: %q)", v)
+		}
+		fmt.Fprintf(w, "  %s\n", name)
+		line := "   "
+		for _, word := range strings.Fields(o.description) {
+			if len(line) > 3 && len(line)+1+len(word) > 80 {
+				fmt.Fprintln(w, line)
+				line = "   "
+			}
+			line += " " + word
+		}
+		if len(line) > 3 {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IcingaPasswordEnv is the name of the environment variable from which the
+// password used to authenticate with the Icinga 2 API may be read.
+const IcingaPasswordEnv = "ICINGA2_API_PASSWORD"
+
+// Maximal duration of a request to the Icinga 2 API.
+const icingaTimeout = 10 * time.Second
+
+// IcingaConfig is the configuration of the submission of passive check
+// results to the Icinga 2 API.
+type IcingaConfig struct {
+	// URL is the base URL of the API, e.g. https://icinga.example.org:5665.
+	URL string
+	// Host and Service are the names of the object the result is submitted
+	// for. If Service is empty, the result is submitted for the host.
+	Host    string
+	Service string
+	// Username and Password are used for basic authentication, if set.
+	Username string
+	Password string
+	// CertFile and KeyFile are the paths to the client certificate and key,
+	// if client certificate authentication is used.
+	CertFile string
+	KeyFile  string
+	// CAFile is the path to the CA bundle used to verify the API's
+	// certificate. The system's pool is used if it is empty.
+	CAFile string
+	// CheckSource is the name of the source of the check result.
+	CheckSource string
+}
+
+// IcingaSink submits results to the Icinga 2 API's process-check-result
+// action.
+type IcingaSink struct {
+	config IcingaConfig
+	client *http.Client
+}
+
+// NewIcingaSink creates a sink for the Icinga 2 API, loading the client
+// certificate and CA bundle if they have been specified.
+func NewIcingaSink(config IcingaConfig) (*IcingaSink, error) {
+	if config.URL == "" || config.Host == "" {
+		return nil, fmt.Errorf("Icinga API URL and host name are required")
+	}
+	tlsConfig := &tls.Config{}
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load Icinga API client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if config.CAFile != "" {
+		data, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load Icinga API CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &IcingaSink{
+		config: config,
+		client: &http.Client{
+			Timeout:   icingaTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Quote a string for use in an Icinga 2 filter expression.
+func icingaQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Request sent to the process-check-result action.
+type icingaCheckResult struct {
+	Type            string   `json:"type"`
+	Filter          string   `json:"filter"`
+	ExitStatus      int      `json:"exit_status"`
+	PluginOutput    string   `json:"plugin_output"`
+	PerformanceData []string `json:"performance_data,omitempty"`
+	CheckSource     string   `json:"check_source,omitempty"`
+}
+
+// Build the request for a result. Host results use the host states, i.e.
+// UP for OK and WARNING and DOWN otherwise.
+func (s *IcingaSink) request(r *Result) icingaCheckResult {
+	req := icingaCheckResult{
+		PluginOutput: r.Output(),
+		CheckSource:  s.config.CheckSource,
+	}
+	for _, pd := range r.PerfData {
+		req.PerformanceData = append(req.PerformanceData, pd.String())
+	}
+	if s.config.Service == "" {
+		req.Type = "Host"
+		req.Filter = "host.name==" + icingaQuote(s.config.Host)
+		if r.Status == OK || r.Status == WARNING {
+			req.ExitStatus = 0
+		} else {
+			req.ExitStatus = 1
+		}
+	} else {
+		req.Type = "Service"
+		req.Filter = "host.name==" + icingaQuote(s.config.Host) +
+			" && service.name==" + icingaQuote(s.config.Service)
+		req.ExitStatus = int(r.Status)
+	}
+	return req
+}
+
+// Response of the process-check-result action.
+type icingaResponse struct {
+	Results []struct {
+		Code   float64 `json:"code"`
+		Status string  `json:"status"`
+	} `json:"results"`
+}
+
+// Submit sends the result to the Icinga 2 API. An error is returned if the
+// request fails or if the API did not process the result.
+func (s *IcingaSink) Submit(r *Result) error {
+	body, err := json.Marshal(s.request(r))
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(s.config.URL, "/") + "/v1/actions/process-check-result"
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.Username != "" {
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var response icingaResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+	if resp.StatusCode != http.StatusOK {
+		if decodeErr == nil && len(response.Results) != 0 {
+			return fmt.Errorf("Icinga API error %d: %s", resp.StatusCode, response.Results[0].Status)
+		}
+		return fmt.Errorf("Icinga API error: %s", resp.Status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("invalid Icinga API response: %w", decodeErr)
+	}
+	if len(response.Results) == 0 {
+		return fmt.Errorf("Icinga API did not find a matching object")
+	}
+	for _, result := range response.Results {
+		if result.Code != http.StatusOK {
+			return fmt.Errorf("Icinga API error %v: %s", result.Code, result.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package plugin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Write a PEM file containing a single block.
+func writePEM(t *testing.T, path, blockType string, data []byte) {
+	t.Helper()
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Generate a self-signed client certificate and write it and its key to
+// the specified directory. Returns the certificate.
+func writeClientCertificate(t *testing.T, dir string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "client.crt"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, "client.key"), "EC PRIVATE KEY", keyDer)
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// Start a stub of the Icinga 2 API which requires client certificates and
+// records the requests it receives.
+func startIcingaStub(t *testing.T, dir string, response string, requests chan<- map[string]interface{}) *httptest.Server {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(writeClientCertificate(t, dir))
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/actions/process-check-result" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests <- body
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	server.StartTLS()
+	writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", server.Certificate().Raw)
+	return server
+}
+
+// Create the result submitted in the tests.
+func icingaTestResult() *Result {
+	return &Result{
+		Name:     "Test",
+		Status:   WARNING,
+		Message:  "almost broken",
+		Lines:    []string{"detail"},
+		PerfData: []*perfdata.PerfData{perfdata.New("time", perfdata.UOM_SECONDS, "0.5")},
+	}
+}
+
+func TestIcingaSink(t *testing.T) {
+	tests := []struct {
+		service  string
+		response string
+		want     map[string]interface{}
+		err      bool
+	}{
+		{
+			service:  "web \"frontend\"",
+			response: `{"results":[{"code":200.0,"status":"Successfully processed check result."}]}`,
+			want: map[string]interface{}{
+				"type":             "Service",
+				"filter":           `host.name=="www" && service.name=="web \"frontend\""`,
+				"exit_status":      1.0,
+				"plugin_output":    "Test WARNING: almost broken\ndetail",
+				"performance_data": []interface{}{"time=0.5s;;;;"},
+				"check_source":     "source",
+			},
+		},
+		{
+			response: `{"results":[{"code":200.0,"status":"Successfully processed check result."}]}`,
+			want: map[string]interface{}{
+				"type":             "Host",
+				"filter":           `host.name=="www"`,
+				"exit_status":      0.0,
+				"plugin_output":    "Test WARNING: almost broken\ndetail",
+				"performance_data": []interface{}{"time=0.5s;;;;"},
+				"check_source":     "source",
+			},
+		},
+		{
+			service:  "web",
+			response: `{"results":[]}`,
+			err:      true,
+		},
+		{
+			service:  "web",
+			response: `{"results":[{"code":500.0,"status":"Attempted to submit a result for a passive check."}]}`,
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		requests := make(chan map[string]interface{}, 1)
+		server := startIcingaStub(t, dir, test.response, requests)
+		sink, err := NewIcingaSink(IcingaConfig{
+			URL:         server.URL + "/",
+			Host:        "www",
+			Service:     test.service,
+			CertFile:    filepath.Join(dir, "client.crt"),
+			KeyFile:     filepath.Join(dir, "client.key"),
+			CAFile:      filepath.Join(dir, "ca.crt"),
+			CheckSource: "source",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sink.Submit(icingaTestResult())
+		server.Close()
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.response)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.response, err)
+			continue
+		}
+		if got := <-requests; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("got request %v, want %v", got, test.want)
+		}
+	}
+}
+
+func TestIcingaSinkErrors(t *testing.T) {
+	dir := t.TempDir()
+	requests := make(chan map[string]interface{}, 1)
+	server := startIcingaStub(t, dir, `{}`, requests)
+	defer server.Close()
+
+	sink, err := NewIcingaSink(IcingaConfig{URL: server.URL, Host: "www", CAFile: filepath.Join(dir, "ca.crt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Submit(icingaTestResult()); err == nil {
+		t.Errorf("submission without a client certificate succeeded")
+	}
+
+	for _, config := range []IcingaConfig{
+		{Host: "www"},
+		{URL: server.URL},
+		{URL: server.URL, Host: "www", CertFile: filepath.Join(dir, "missing.crt")},
+		{URL: server.URL, Host: "www", CAFile: filepath.Join(dir, "client.key")},
+	} {
+		if _, err := NewIcingaSink(config); err == nil {
+			t.Errorf("%+v: expected an error", config)
+		}
+	}
+}
+
+// A sink that records the results it receives.
+type testSink struct {
+	results []*Result
+	err     error
+}
+
+func (s *testSink) Submit(r *Result) error {
+	s.results = append(s.results, r)
+	return s.err
+}
+
+func TestDoneWithSink(t *testing.T) {
+	for _, sinkErr := range []error{nil, errors.New("unreachable")} {
+		var output, errOutput strings.Builder
+		code := -1
+		p := New("Test")
+		p.output = &output
+		p.errOutput = &errOutput
+		p.exit = func(c int) { code = c }
+		sink := &testSink{err: sinkErr}
+		p.SetSink(sink)
+		p.SetState(CRITICAL, "broken")
+		p.Done()
+
+		if len(sink.results) != 1 || sink.results[0].Message != "broken" {
+			t.Errorf("%v: unexpected submitted results %v", sinkErr, sink.results)
+		}
+		if sinkErr == nil {
+			if code != 0 || output.Len() != 0 || errOutput.Len() != 0 {
+				t.Errorf("unexpected exit code %d or output %q %q", code, output.String(), errOutput.String())
+			}
+		} else {
+			if code != 2 || output.String() != "Test ERROR: broken\n" ||
+				errOutput.String() != "could not submit result: unreachable\n" {
+				t.Errorf("unexpected exit code %d or output %q %q", code, output.String(), errOutput.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Maximal delay for connecting to a metrics socket and writing to it.
+const metricsTimeout = 5 * time.Second
+
+// Configuration of the export of the plugin's performance data.
+type metricsExport struct {
+	format      perfdata.ExportFormat
+	destination string
+	host        string
+}
+
+// SetMetricsExport configures the plugin to export its performance data when
+// Done is called, in addition to generating its normal output. The
+// destination is either a file name or a socket address using the tcp://,
+// udp:// or unix:// schemes. Metrics are appended to files, except when
+// using the OpenMetrics format: as each export is a complete exposition,
+// the file is replaced instead, and its samples have no timestamps so that
+// it may be read by the node exporter's textfile collector. The host name
+// is used to tag the metrics.
+func (p *Plugin) SetMetricsExport(format perfdata.ExportFormat, destination, host string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.metrics = &metricsExport{
+		format:      format,
+		destination: destination,
+		host:        host,
+	}
+}
+
+// Get the network and address of the destination if it is a socket.
+func (m *metricsExport) socket() (string, string, bool) {
+	for _, network := range []string{"tcp", "udp", "unix"} {
+		prefix := network + "://"
+		if strings.HasPrefix(m.destination, prefix) {
+			return network, m.destination[len(prefix):], true
+		}
+	}
+	return "", "", false
+}
+
+// Open the destination of the metrics.
+func (m *metricsExport) open() (io.WriteCloser, error) {
+	if network, address, ok := m.socket(); ok {
+		conn, err := net.DialTimeout(network, address, metricsTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conn.SetDeadline(time.Now().Add(metricsTimeout))
+		return conn, nil
+	}
+	return os.OpenFile(m.destination, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+// Replace the contents of a file. The data is written to a temporary file
+// which is then renamed, so that readers never see a partial file.
+func replaceFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Export a result's performance data. The metrics are rendered into a
+// buffer first so that they are written in a single operation.
+func (m *metricsExport) export(r *Result) error {
+	if len(r.PerfData) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	source := perfdata.ExportSource{
+		Plugin: r.Name,
+		Host:   m.host,
+		Time:   time.Now(),
+	}
+	_, _, isSocket := m.socket()
+	textfile := !isSocket && m.format == perfdata.EXPORT_OPENMETRICS
+	if textfile {
+		source.Time = time.Time{}
+	}
+	if err := perfdata.Export(&buf, m.format, source, r.PerfData); err != nil {
+		return err
+	}
+	if textfile {
+		return replaceFile(m.destination, buf.Bytes())
+	}
+	out, err := m.open()
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(buf.Bytes())
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Export the plugin's metrics if an export has been configured. This is
+// done before the output is generated, but as the result has already been
+// computed, errors are written to the error output rather than added to it.
+func (p *Plugin) exportMetrics(r *Result) {
+	p.lock.Lock()
+	metrics := p.metrics
+	p.lock.Unlock()
+	if metrics == nil {
+		return
+	}
+	if err := metrics.export(r); err != nil {
+		fmt.Fprintf(p.errOutput, "could not export metrics to %s: %v\n", metrics.destination, err)
+	}
+}
@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Create a plugin with some performance data that will not exit when Done
+// is called.
+func metricsTestPlugin() *Plugin {
+	p := New("Test")
+	p.output = ioutil.Discard
+	p.exit = func(int) {}
+	p.SetState(OK, "fine")
+	p.AddPerfData(perfdata.New("time", perfdata.UOM_SECONDS, "0.5"))
+	return p
+}
+
+func TestMetricsExportFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.txt")
+	for i := 0; i < 2; i++ {
+		p := metricsTestPlugin()
+		p.SetMetricsExport(perfdata.EXPORT_GRAPHITE, path, "host")
+		p.Done()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	re := regexp.MustCompile(`^host\.Test\.time 0\.5 \d+$`)
+	if len(lines) != 2 || !re.MatchString(lines[0]) || !re.MatchString(lines[1]) {
+		t.Errorf("unexpected metrics file contents %q", data)
+	}
+}
+
+func TestMetricsExportOpenMetricsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	for i := 0; i < 2; i++ {
+		p := metricsTestPlugin()
+		p.SetMetricsExport(perfdata.EXPORT_OPENMETRICS, path, "host")
+		p.Done()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "# EOF\n"); n != 1 || !strings.HasSuffix(string(data), "# EOF\n") ||
+		!strings.Contains(string(data), `plugin="Test"} 0.5`+"\n") {
+		t.Errorf("unexpected metrics file contents %q", data)
+	}
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v %v", entries, err)
+	}
+}
+
+func TestMetricsExportSocket(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	p := metricsTestPlugin()
+	p.SetMetricsExport(perfdata.EXPORT_INFLUXDB, "tcp://"+listener.Addr().String(), "host")
+	p.Done()
+	line := <-received
+	if !regexp.MustCompile(`^Test,host=host,label=time,unit=s value=0\.5 \d+\n$`).MatchString(line) {
+		t.Errorf("unexpected metrics %q", line)
+	}
+}
+
+func TestMetricsExportError(t *testing.T) {
+	p := metricsTestPlugin()
+	var errOutput strings.Builder
+	p.errOutput = &errOutput
+	p.SetMetricsExport(perfdata.EXPORT_GRAPHITE, filepath.Join(t.TempDir(), "missing", "file"), "host")
+	p.Done()
+	if !strings.HasPrefix(errOutput.String(), "could not export metrics to ") {
+		t.Errorf("unexpected error output %q", errOutput.String())
+	}
+}
@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Escape backslashes and new lines in a result's output so that it fits on
+// a single line; Nagios reverses this when it reads the result.
+var nagiosEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// Get the return code of a result when it is submitted for a host, i.e. UP
+// for OK and WARNING and DOWN otherwise.
+func hostReturnCode(status Status) int {
+	if status == OK || status == WARNING {
+		return 0
+	}
+	return 1
+}
+
+// CheckResultSink writes results as passive check result files into the
+// Nagios check result spool directory.
+type CheckResultSink struct {
+	dir     string
+	host    string
+	service string
+	now     func() time.Time
+}
+
+// NewCheckResultSink creates a sink that writes results for the specified
+// host and service into the Nagios check result spool directory. If the
+// service is empty, host check results are written.
+func NewCheckResultSink(dir, host, service string) *CheckResultSink {
+	return &CheckResultSink{
+		dir:     dir,
+		host:    host,
+		service: service,
+		now:     time.Now,
+	}
+}
+
+// Characters used in the names of check result files.
+const checkResultChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Create a new check result file. Nagios only reads files whose name is made
+// of the 'c' character followed by 6 characters.
+func (s *CheckResultSink) create() (*os.File, error) {
+	for attempt := 0; attempt < 100; attempt++ {
+		random := make([]byte, 6)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		for i := range random {
+			random[i] = checkResultChars[int(random[i])%len(checkResultChars)]
+		}
+		path := filepath.Join(s.dir, "c"+string(random))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+		if !os.IsExist(err) {
+			return f, err
+		}
+	}
+	return nil, fmt.Errorf("could not find a free check result file name in %s", s.dir)
+}
+
+// Generate the contents of a check result file.
+func (s *CheckResultSink) contents(r *Result) []byte {
+	now := s.now()
+	timestamp := fmt.Sprintf("%d.%06d", now.Unix(), now.Nanosecond()/1000)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "### Passive Check Result File ###\nfile_time=%d\n\n", now.Unix())
+	returnCode := int(r.Status)
+	if s.service == "" {
+		fmt.Fprintf(&buf, "### Nagios Host Check Result ###\n")
+		returnCode = hostReturnCode(r.Status)
+	} else {
+		fmt.Fprintf(&buf, "### Nagios Service Check Result ###\n")
+	}
+	fmt.Fprintf(&buf, "# Time: %s\n", now.Format(time.ANSIC))
+	fmt.Fprintf(&buf, "host_name=%s\n", s.host)
+	if s.service != "" {
+		fmt.Fprintf(&buf, "service_description=%s\n", s.service)
+	}
+	fmt.Fprintf(&buf, "check_type=1\ncheck_options=0\nscheduled_check=0\nreschedule_check=0\n")
+	fmt.Fprintf(&buf, "latency=0.0\nstart_time=%s\nfinish_time=%s\n", timestamp, timestamp)
+	fmt.Fprintf(&buf, "early_timeout=0\nexited_ok=1\nreturn_code=%d\n", returnCode)
+	fmt.Fprintf(&buf, "output=%s\n", nagiosEscaper.Replace(r.String()))
+	return buf.Bytes()
+}
+
+// Submit writes the result to a new file in the spool directory, then
+// creates the corresponding ".ok" file which indicates to Nagios that the
+// result file is complete.
+func (s *CheckResultSink) Submit(r *Result) error {
+	f, err := s.create()
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(s.contents(r))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	ok, err := os.OpenFile(f.Name()+".ok", os.O_WRONLY|os.O_CREATE, 0660)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return ok.Close()
+}
+
+// CommandFileSink writes results as external commands into the Nagios
+// command file.
+type CommandFileSink struct {
+	path    string
+	host    string
+	service string
+	now     func() time.Time
+}
+
+// NewCommandFileSink creates a sink that submits results for the specified
+// host and service through the Nagios external command file. If the
+// service is empty, host check results are submitted.
+func NewCommandFileSink(path, host, service string) *CommandFileSink {
+	return &CommandFileSink{
+		path:    path,
+		host:    host,
+		service: service,
+		now:     time.Now,
+	}
+}
+
+// Generate the external command for a result.
+func (s *CommandFileSink) command(r *Result) string {
+	output := nagiosEscaper.Replace(r.String())
+	if s.service == "" {
+		return fmt.Sprintf("[%d] PROCESS_HOST_CHECK_RESULT;%s;%d;%s\n",
+			s.now().Unix(), s.host, hostReturnCode(r.Status), output)
+	}
+	return fmt.Sprintf("[%d] PROCESS_SERVICE_CHECK_RESULT;%s;%s;%d;%s\n",
+		s.now().Unix(), s.host, s.service, r.Status, output)
+}
+
+// Submit writes the external command to the command file. The file is
+// opened without blocking, so that the submission fails immediately if the
+// command file is a pipe that Nagios is not reading.
+func (s *CommandFileSink) Submit(r *Result) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(s.command(r)))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Create the result submitted in the tests.
+func nagiosTestResult() *Result {
+	return &Result{
+		Name:     "Test",
+		Status:   CRITICAL,
+		Message:  `broken C:\`,
+		Lines:    []string{"detail"},
+		PerfData: []*perfdata.PerfData{perfdata.New("time", perfdata.UOM_SECONDS, "0.5")},
+	}
+}
+
+// Time used in the tests.
+var nagiosTestTime = time.Date(2020, 9, 13, 12, 26, 40, 250000000, time.UTC)
+
+func TestCheckResultSink(t *testing.T) {
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{
+			service: "web",
+			want: "### Passive Check Result File ###\nfile_time=1600000000\n\n" +
+				"### Nagios Service Check Result ###\n# Time: Sun Sep 13 12:26:40 2020\n" +
+				"host_name=www\nservice_description=web\n" +
+				"check_type=1\ncheck_options=0\nscheduled_check=0\nreschedule_check=0\n" +
+				"latency=0.0\nstart_time=1600000000.250000\nfinish_time=1600000000.250000\n" +
+				"early_timeout=0\nexited_ok=1\nreturn_code=2\n" +
+				`output=Test ERROR: broken C:\\ | time=0.5s;;;;\ndetail` + "\n",
+		},
+		{
+			want: "### Passive Check Result File ###\nfile_time=1600000000\n\n" +
+				"### Nagios Host Check Result ###\n# Time: Sun Sep 13 12:26:40 2020\n" +
+				"host_name=www\n" +
+				"check_type=1\ncheck_options=0\nscheduled_check=0\nreschedule_check=0\n" +
+				"latency=0.0\nstart_time=1600000000.250000\nfinish_time=1600000000.250000\n" +
+				"early_timeout=0\nexited_ok=1\nreturn_code=1\n" +
+				`output=Test ERROR: broken C:\\ | time=0.5s;;;;\ndetail` + "\n",
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		sink := NewCheckResultSink(dir, "www", test.service)
+		sink.now = func() time.Time { return nagiosTestTime }
+		if err := sink.Submit(nagiosTestResult()); err != nil {
+			t.Fatal(err)
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, "*"))
+		if len(files) != 2 || files[0]+".ok" != files[1] {
+			t.Fatalf("unexpected files %v", files)
+		}
+		if !regexp.MustCompile(`^c[a-zA-Z0-9]{6}$`).MatchString(filepath.Base(files[0])) {
+			t.Errorf("invalid check result file name %s", files[0])
+		}
+		data, _ := ioutil.ReadFile(files[0])
+		if string(data) != test.want {
+			t.Errorf("got\n%s\nwant\n%s", data, test.want)
+		}
+	}
+
+	sink := NewCheckResultSink(filepath.Join(t.TempDir(), "missing"), "www", "web")
+	if err := sink.Submit(nagiosTestResult()); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestCommandFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nagios.cmd")
+	sink := NewCommandFileSink(path, "www", "web")
+	if err := sink.Submit(nagiosTestResult()); err == nil {
+		t.Errorf("missing command file: expected an error")
+	}
+
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"web", ""} {
+		sink := NewCommandFileSink(path, "www", service)
+		sink.now = func() time.Time { return nagiosTestTime }
+		if err := sink.Submit(nagiosTestResult()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := ioutil.ReadFile(path)
+	want := `[1600000000] PROCESS_SERVICE_CHECK_RESULT;www;web;2;Test ERROR: broken C:\\ | time=0.5s;;;;\ndetail` + "\n" +
+		`[1600000000] PROCESS_HOST_CHECK_RESULT;www;1;Test ERROR: broken C:\\ | time=0.5s;;;;\ndetail` + "\n"
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+}
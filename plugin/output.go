@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// OutputFormat indicates how the plugin's result will be rendered.
+type OutputFormat int
+
+// Output formats.
+const (
+	// Classic monitoring plugin text output.
+	OUTPUT_TEXT OutputFormat = iota
+	// JSON document.
+	OUTPUT_JSON
+)
+
+// OutputFormatEnv is the name of the environment variable that may be used
+// to select the output format.
+const OutputFormatEnv = "MONITORING_PLUGIN_OUTPUT"
+
+// String representations of the output formats.
+func (f OutputFormat) String() string {
+	return [...]string{"text", "json"}[f]
+}
+
+// ParseOutputFormat converts the name of an output format to the
+// corresponding value.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch name {
+	case "text":
+		return OUTPUT_TEXT, nil
+	case "json":
+		return OUTPUT_JSON, nil
+	}
+	return OUTPUT_TEXT, fmt.Errorf("unsupported output format '%s'", name)
+}
+
+// Get the output format from the environment. If the variable is not set
+// or contains an invalid value, the text format is used.
+func outputFormatFromEnv() OutputFormat {
+	format, _ := ParseOutputFormat(os.Getenv(OutputFormatEnv))
+	return format
+}
+
+// MarshalJSON converts the result to a JSON document which includes the
+// status, message, output lines and structured performance data.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	lines := r.Lines
+	if lines == nil {
+		lines = []string{}
+	}
+	pd := r.PerfData
+	if pd == nil {
+		pd = []*perfdata.PerfData{}
+	}
+	return json.Marshal(struct {
+		Name     string               `json:"name"`
+		Status   string               `json:"status"`
+		Code     int                  `json:"code"`
+		Message  string               `json:"message"`
+		Lines    []string             `json:"lines"`
+		PerfData []*perfdata.PerfData `json:"perfdata"`
+	}{
+		Name:     r.Name,
+		Status:   r.Status.String(),
+		Code:     int(r.Status),
+		Message:  r.Message,
+		Lines:    lines,
+		PerfData: pd,
+	})
+}
+
+// WriteJSON writes the result to the specified writer as a JSON document.
+func (r *Result) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// Render writes the result to the specified writer using the specified
+// output format.
+func (r *Result) Render(w io.Writer, format OutputFormat) error {
+	if format == OUTPUT_JSON {
+		return r.WriteJSON(w)
+	}
+	_, err := r.WriteTo(w)
+	return err
+}
@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, format := range []OutputFormat{OUTPUT_TEXT, OUTPUT_JSON} {
+		if got, err := ParseOutputFormat(format.String()); err != nil || got != format {
+			t.Errorf("%v: got %v, %v", format, got, err)
+		}
+	}
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestOutputFormatFromEnv(t *testing.T) {
+	defer os.Unsetenv(OutputFormatEnv)
+	os.Setenv(OutputFormatEnv, "json")
+	if p := New("Test"); p.format != OUTPUT_JSON {
+		t.Errorf("got %v, want %v", p.format, OUTPUT_JSON)
+	}
+	os.Setenv(OutputFormatEnv, "invalid")
+	if p := New("Test"); p.format != OUTPUT_TEXT {
+		t.Errorf("got %v, want %v", p.format, OUTPUT_TEXT)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	pd := perfdata.New("time", perfdata.UOM_SECONDS, "0.5")
+	pd.SetWarn(perfdata.PDRMax("1"))
+	pd.SetCrit(perfdata.PDRMinMax("~", "2").Inside())
+	pd.SetMin("0")
+	r := &Result{
+		Name:     "Test",
+		Status:   CRITICAL,
+		Message:  "broken",
+		Lines:    []string{"detail"},
+		PerfData: []*perfdata.PerfData{pd, perfdata.New("n", perfdata.UOM_NONE, "")},
+	}
+	var sb strings.Builder
+	if err := r.Render(&sb, OUTPUT_JSON); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"name":"Test","status":"ERROR","code":2,"message":"broken","lines":["detail"],` +
+		`"perfdata":[{"label":"time","value":0.5,"unit":"s","warn":{"start":0,"end":1},` +
+		`"crit":{"end":2,"inside":true},"min":0},{"label":"n","value":null}]}` + "\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	sb.Reset()
+	if err := (&Result{Name: "Test", Message: "fine"}).Render(&sb, OUTPUT_JSON); err != nil {
+		t.Fatal(err)
+	}
+	want = `{"name":"Test","status":"OK","code":0,"message":"fine","lines":[],"perfdata":[]}` + "\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
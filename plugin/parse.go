@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Regexp used to extract the name, status and message from the first line
+// of a plugin's output.
+var statusLineRegexp = regexp.MustCompile(
+	`^(?:(.*?) )?(OK|WARNING|CRITICAL|ERROR|UNKNOWN)(?:(?::| -)? (.*))?$`)
+
+// ParseStatus converts a status name to the corresponding status. Both
+// "CRITICAL" and "ERROR" are accepted for critical states.
+func ParseStatus(name string) (Status, error) {
+	switch name {
+	case "OK":
+		return OK, nil
+	case "WARNING":
+		return WARNING, nil
+	case "CRITICAL", "ERROR":
+		return CRITICAL, nil
+	case "UNKNOWN":
+		return UNKNOWN, nil
+	}
+	return UNKNOWN, fmt.Errorf("invalid status '%s'", name)
+}
+
+// Split a line of output at the first '|' character, returning the text
+// and the performance data.
+func splitPerfData(line string) (string, string, bool) {
+	sep := strings.IndexByte(line, '|')
+	if sep == -1 {
+		return line, "", false
+	}
+	return line[:sep], line[sep+1:], true
+}
+
+// ParseResult reads a plugin's output and converts it to a result. The first
+// line may contain performance data after a '|' character. It may be
+// followed by long output lines, the last of which may also be followed by
+// a '|' character and performance data, which may then continue on the
+// subsequent lines.
+//
+// If the first line's text is of the form "name STATUS: message", the
+// result's name, status and message are set accordingly. Otherwise the
+// status is UNKNOWN and the whole text is used as the message; the caller
+// may then set the status based on the plugin's exit code.
+//
+// Invalid performance data records are skipped; if there are any, the result
+// is returned along with an error that describes them.
+func ParseResult(output string) (*Result, error) {
+	lines := strings.Split(strings.TrimRight(output, "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+
+	text, pdText, _ := splitPerfData(lines[0])
+	r := &Result{Status: UNKNOWN}
+	text = strings.TrimSpace(text)
+	if m := statusLineRegexp.FindStringSubmatch(text); m != nil {
+		r.Name = m[1]
+		r.Status, _ = ParseStatus(m[2])
+		r.Message = m[3]
+	} else {
+		r.Message = text
+	}
+
+	inPerfData := false
+	for _, line := range lines[1:] {
+		if inPerfData {
+			pdText += " " + line
+			continue
+		}
+		text, pd, found := splitPerfData(line)
+		if found {
+			inPerfData = true
+			pdText += " " + pd
+			text = strings.TrimRight(text, " \t")
+		}
+		r.Lines = append(r.Lines, text)
+	}
+
+	pd, err := perfdata.Parse(pdText)
+	if len(pd) > 0 {
+		r.PerfData = pd
+	}
+	return r, err
+}
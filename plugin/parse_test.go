@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"testing"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+func TestParseStatus(t *testing.T) {
+	for _, s := range []Status{OK, WARNING, CRITICAL, UNKNOWN} {
+		if got, err := ParseStatus(s.String()); err != nil || got != s {
+			t.Errorf("%v: got %v, %v", s, got, err)
+		}
+	}
+	if got, err := ParseStatus("CRITICAL"); err != nil || got != CRITICAL {
+		t.Errorf("CRITICAL: got %v, %v", got, err)
+	}
+	if _, err := ParseStatus("BROKEN"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	output := "DISK OK - free space: / 3326 MB (56%); | /=2643MB;5948;5958;0;5968\n" +
+		"/ 15272 MB (77%);\n" +
+		"/boot 68 MB (69%);\n" +
+		"/var/log 819 MB (84%); | /boot=68MB;88;93;0;98\n" +
+		"/home=69357MB;253404;253409;0;253414\n" +
+		"/var/log=818MB;970;975;0;980\n"
+	r, err := ParseResult(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "DISK" || r.Status != OK || r.Message != "free space: / 3326 MB (56%);" {
+		t.Errorf("unexpected status line %q %v %q", r.Name, r.Status, r.Message)
+	}
+	wantLines := []string{"/ 15272 MB (77%);", "/boot 68 MB (69%);", "/var/log 819 MB (84%);"}
+	if len(r.Lines) != len(wantLines) {
+		t.Fatalf("got lines %q, want %q", r.Lines, wantLines)
+	}
+	for i := range wantLines {
+		if r.Lines[i] != wantLines[i] {
+			t.Errorf("line %d: got %q, want %q", i, r.Lines[i], wantLines[i])
+		}
+	}
+	wantLabels := []string{"/", "/boot", "/home", "/var/log"}
+	if len(r.PerfData) != len(wantLabels) {
+		t.Fatalf("got %d performance data records, want %d", len(r.PerfData), len(wantLabels))
+	}
+	for i := range wantLabels {
+		if r.PerfData[i].Label != wantLabels[i] {
+			t.Errorf("record %d: got %q, want %q", i, r.PerfData[i].Label, wantLabels[i])
+		}
+	}
+}
+
+func TestParseResultFreeForm(t *testing.T) {
+	r, err := ParseResult("something happened")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "" || r.Status != UNKNOWN || r.Message != "something happened" {
+		t.Errorf("unexpected result %v", r)
+	}
+	if _, err := ParseResult("OK | broken"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestParseResultThirdParty(t *testing.T) {
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{
+			"OK - 2014 MB free | TOTAL=8059256KB;;;; USED=5996804KB;6447404;7253330;; FREE=2062452KB;;;;\n",
+			[]string{"TOTAL=8059256KB;;;;", "USED=5996804KB;:6447404;:7253330;;", "FREE=2062452KB;;;;"},
+		},
+		{
+			"OK - interface eth0 usage is in:0.00% (10.50Bits/s) out:0.00% (25.31Bits/s) | " +
+				"'eth0_usage_in'=0%;80;90;0;100 'eth0_traffic_in'=10.50Bits/s;;;0;\n",
+			[]string{"eth0_usage_in=0%;:80;:90;0;100", "eth0_traffic_in=10.50Bits/s;;;0;"},
+		},
+		{
+			"OK: CPU load is ok.|'total 5m'=2%;80;90 'total 1m'=3%;80;90\n",
+			[]string{"'total 5m'=2%;:80;:90;;", "'total 1m'=3%;:80;:90;;"},
+		},
+		{
+			"SENSOR OK - all values in range | temp=1.5e-3;;;0; in=12KiB rate=5bps\n",
+			[]string{"temp=0.0015;;;0;", "in=12KiB;;;;", "rate=5bps;;;;"},
+		},
+	}
+	for _, test := range tests {
+		r, err := ParseResult(test.output)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.output, err)
+			continue
+		}
+		if len(r.PerfData) != len(test.want) {
+			t.Errorf("%q: got %d records, want %d", test.output, len(r.PerfData), len(test.want))
+			continue
+		}
+		for i := range test.want {
+			if got := r.PerfData[i].String(); got != test.want[i] {
+				t.Errorf("%q: record %d: got %q, want %q", test.output, i, got, test.want[i])
+			}
+		}
+	}
+}
+
+func TestParseResultInvalidPerfData(t *testing.T) {
+	r, err := ParseResult("OK - fine | a=1 b=x;; c=2s\n")
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if r == nil || r.Status != OK || r.Message != "fine" || len(r.PerfData) != 2 {
+		t.Errorf("unexpected result %v", r)
+	}
+}
+
+func TestParseResultRoundTrip(t *testing.T) {
+	pd := perfdata.New("it's", perfdata.UOM_SECONDS, "0.25")
+	pd.SetWarn(perfdata.PDRMax("1"))
+	results := []*Result{
+		{Name: "Test", Status: OK, Message: "fine"},
+		{Name: "DNS zone serial match check", Status: CRITICAL, Message: "serials mismatch",
+			Lines:    []string{"serial on checked server: 1", "serial on reference server: 2"},
+			PerfData: []*perfdata.PerfData{pd, perfdata.New("x y", perfdata.UOM_NONE, "")}},
+		{Name: "Test", Status: WARNING, Message: "odd: really", Lines: []string{"[WARNING] odd"}},
+	}
+	for _, r := range results {
+		parsed, err := ParseResult(r.String() + "\n")
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", r, err)
+			continue
+		}
+		if got, want := parsed.String(), r.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
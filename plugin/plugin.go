@@ -4,9 +4,13 @@ package plugin
 
 import (
 	"container/list"
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"sort"
+	"sync"
+	"time"
 
 	"nocternity.net/go/monitoring/perfdata"
 )
@@ -30,45 +34,137 @@ func (s Status) String() string {
 }
 
 // Plugin represents the monitoring plugin's state, including its name,
-// return status and message, additional lines of text, and performance
-// data to be encoded in the output.
+// return status and message, sub-results, additional lines of text, and
+// performance data to be encoded in the output. The plugin's methods may be
+// called from multiple goroutines.
 type Plugin struct {
-	name      string
-	status    Status
-	message   string
-	extraText *list.List
-	perfData  map[string]*perfdata.PerfData
+	lock         sync.Mutex
+	name         string
+	status       Status
+	message      string
+	stateSet     bool
+	policy       Policy
+	subResults   []SubResult
+	extraText    *list.List
+	perfData     []*perfdata.PerfData
+	perfIndex    map[string]int
+	sortPerfData bool
+	format       OutputFormat
+	verbosity    int
+	metrics      *metricsExport
+	sink         Sink
+	stateStore   *StateStore
+	stateArgs    []string
+	ctx          context.Context
+	cancel       context.CancelFunc
+	timeoutCtx   context.Context
+	timeoutStop  context.CancelFunc
+	timer        *time.Timer
+	timeout      time.Duration
+	timeoutState Status
+	done         sync.Once
+	output       io.Writer
+	errOutput    io.Writer
+	exit         func(int)
 }
 
-// New creates the plugin with `name` as its name and an unknown status.
+// New creates the plugin with `name` as its name and an unknown status. The
+// output format is read from the environment variable named by
+// OutputFormatEnv, and defaults to text.
 func New(name string) *Plugin {
 	p := new(Plugin)
 	p.name = name
 	p.status = UNKNOWN
 	p.message = "no status set"
-	p.perfData = make(map[string]*perfdata.PerfData)
+	p.perfIndex = make(map[string]int)
+	p.format = outputFormatFromEnv()
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.output = os.Stdout
+	p.errOutput = os.Stderr
+	p.exit = os.Exit
 	return p
 }
 
+// SetOutputFormat sets the format that will be used to render the plugin's
+// result when Done is called.
+func (p *Plugin) SetOutputFormat(format OutputFormat) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.format = format
+}
+
+// SetVerbosity sets the plugin's verbosity level, from VERBOSE_NONE to
+// VERBOSE_DEBUG.
+func (p *Plugin) SetVerbosity(verbosity int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if verbosity > VERBOSE_DEBUG {
+		verbosity = VERBOSE_DEBUG
+	}
+	p.verbosity = verbosity
+}
+
+// Verbosity returns the plugin's verbosity level.
+func (p *Plugin) Verbosity() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.verbosity
+}
+
 // SetState sets the plugin's output code to `status` and its message to
-// the specified `message`.
+// the specified `message`. This overrides the status and message that would
+// otherwise be computed from the sub-results.
 func (p *Plugin) SetState(status Status, message string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.status = status
 	p.message = message
+	p.stateSet = true
 }
 
-// AddLine adds the specified string to the extra output text buffer.
-func (p *Plugin) AddLine(format string, data ...interface{}) {
+// SetPolicy sets the policy that is used to compute the plugin's status
+// from its sub-results. The default policy is POLICY_WORST.
+func (p *Plugin) SetPolicy(policy Policy) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.policy = policy
+}
+
+// AddResult adds a sub-result with the specified status and message. Unless
+// SetState is called, the plugin's status will be computed from its
+// sub-results according to its policy, and its message will list the
+// messages of the sub-results that have this status. Each sub-result will
+// also be listed in the output text.
+func (p *Plugin) AddResult(status Status, message string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.subResults = append(p.subResults, SubResult{
+		Status:  status,
+		Message: message,
+	})
+}
+
+// Add a line to the extra output text buffer. The plugin's lock must be held.
+func (p *Plugin) addLine(line string) {
 	if p.extraText == nil {
 		p.extraText = list.New()
 	}
-	p.extraText.PushBack(fmt.Sprintf(format, data...))
+	p.extraText.PushBack(line)
+}
+
+// AddLine adds the specified string to the extra output text buffer.
+func (p *Plugin) AddLine(format string, data ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.addLine(fmt.Sprintf(format, data...))
 }
 
 // AddLines add the specified `lines` to the output text.
 func (p *Plugin) AddLines(lines []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	for _, line := range lines {
-		p.AddLine("%s", line)
+		p.addLine(line)
 	}
 }
 
@@ -76,41 +172,123 @@ func (p *Plugin) AddLines(lines []string) {
 // output's performance data. If two performance data records are added for
 // the same label, the program panics.
 func (p *Plugin) AddPerfData(pd *perfdata.PerfData) {
-	_, exists := p.perfData[pd.Label]
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, exists := p.perfIndex[pd.Label]
 	if exists {
 		panic(fmt.Sprintf("duplicate performance data %s", pd.Label))
 	}
-	p.perfData[pd.Label] = pd
+	p.perfIndex[pd.Label] = len(p.perfData)
+	p.perfData = append(p.perfData, pd)
 }
 
-// Done generates the plugin's text output from its name, status, text data
-// and performance data, before exiting with the code corresponding to the
-// status.
-func (p *Plugin) Done() {
-	var sb strings.Builder
-	sb.WriteString(p.name)
-	sb.WriteString(" ")
-	sb.WriteString(p.status.String())
-	sb.WriteString(": ")
-	sb.WriteString(p.message)
-	if len(p.perfData) > 0 {
-		sb.WriteString(" | ")
-		needSep := false
-		for k := range p.perfData {
-			if needSep {
-				sb.WriteString(", ")
-			} else {
-				needSep = true
-			}
-			sb.WriteString(p.perfData[k].String())
+// SetPerfData adds performance data described by the "pd" argument to the
+// output's performance data. If a record with the same label exists, it is
+// replaced, keeping its position in the output.
+func (p *Plugin) SetPerfData(pd *perfdata.PerfData) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if index, exists := p.perfIndex[pd.Label]; exists {
+		p.perfData[index] = pd
+	} else {
+		p.perfIndex[pd.Label] = len(p.perfData)
+		p.perfData = append(p.perfData, pd)
+	}
+}
+
+// MergePerfData adds performance data described by the "pd" argument to the
+// output's performance data. If a record with the same label exists, the
+// value and all elements that are set in "pd" are copied into it.
+func (p *Plugin) MergePerfData(pd *perfdata.PerfData) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if index, exists := p.perfIndex[pd.Label]; exists {
+		p.perfData[index].Merge(pd)
+	} else {
+		p.perfIndex[pd.Label] = len(p.perfData)
+		p.perfData = append(p.perfData, pd)
+	}
+}
+
+// SortPerfData sets whether the performance data will be sorted by label in
+// the output. By default, records are emitted in the order in which they
+// were added.
+func (p *Plugin) SortPerfData(sorted bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sortPerfData = sorted
+}
+
+// Result builds the plugin's result from its current name, status,
+// sub-results, text data and performance data. If the plugin's timeout has
+// expired, the result's status is the timeout state and the message that
+// would otherwise have been used is added to the output text.
+func (p *Plugin) Result() *Result {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	r := &Result{
+		Name:    p.name,
+		Status:  p.status,
+		Message: p.message,
+	}
+	if len(p.subResults) > 0 && !p.stateSet {
+		r.Status = Aggregate(p.policy, p.subResults)
+		r.Message = Summarize(r.Status, p.subResults)
+	}
+	if p.context().Err() == context.DeadlineExceeded {
+		if p.stateSet || len(p.subResults) > 0 {
+			r.Lines = append(r.Lines, r.Message)
 		}
+		r.Status = p.timeoutState
+		r.Message = fmt.Sprintf("check timed out after %v", p.timeout)
+	}
+	for _, sr := range p.subResults {
+		r.Lines = append(r.Lines, sr.String())
 	}
 	if p.extraText != nil {
 		for em := p.extraText.Front(); em != nil; em = em.Next() {
-			sb.WriteString("\n")
-			sb.WriteString(em.Value.(string))
+			r.Lines = append(r.Lines, em.Value.(string))
 		}
 	}
-	fmt.Println(sb.String())
-	os.Exit(int(p.status))
+	if len(p.perfData) > 0 {
+		r.PerfData = make([]*perfdata.PerfData, len(p.perfData))
+		copy(r.PerfData, p.perfData)
+		if p.sortPerfData {
+			sort.SliceStable(r.PerfData, func(i, j int) bool {
+				return r.PerfData[i].Label < r.PerfData[j].Label
+			})
+		}
+	}
+	return r
+}
+
+// Done generates the plugin's output from its name, status, text data and
+// performance data using the selected output format, and exports its
+// performance data if this has been configured, before exiting with
+// the code corresponding to the status. If a sink has been set, the result
+// is submitted to it instead of being written to the output, and the
+// program exits with a zero code; if the submission fails, the error is
+// reported and the output is generated as usual. If Done is called more
+// than once, for example because the timeout expired while the check was
+// running, the output is only generated by the first call.
+func (p *Plugin) Done() {
+	p.done.Do(func() {
+		r := p.Result()
+		p.lock.Lock()
+		format, sink := p.format, p.sink
+		p.lock.Unlock()
+		p.exportMetrics(r)
+		if sink != nil {
+			err := sink.Submit(r)
+			if err == nil {
+				p.release()
+				p.exit(int(OK))
+				return
+			}
+			fmt.Fprintf(p.errOutput, "could not submit result: %v\n", err)
+		}
+		r.Render(p.output, format)
+		p.release()
+		p.exit(int(r.Status))
+	})
 }
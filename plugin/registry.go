@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a new instance of a check. As checks store their
+// configuration, a new instance must be used each time a check is run.
+type Factory func() Check
+
+// Registration describes a check that has been registered.
+type Registration struct {
+	// Command is the name used to select the check, e.g. the name of its
+	// standalone binary.
+	Command string
+	// Name is the plugin's name, as displayed in its output.
+	Name string
+	// New creates an instance of the check.
+	New Factory
+}
+
+// The registered checks, indexed by command.
+var (
+	registryLock sync.Mutex
+	registry     = make(map[string]Registration)
+)
+
+// Register adds a check to the registry. It is meant to be called from the
+// init function of the check's package. The program panics if two checks
+// are registered with the same command.
+func Register(command, name string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, exists := registry[command]; exists {
+		panic(fmt.Sprintf("duplicate check registration %s", command))
+	}
+	registry[command] = Registration{
+		Command: command,
+		Name:    name,
+		New:     factory,
+	}
+}
+
+// Lookup finds the check that has been registered with the specified
+// command.
+func Lookup(command string) (Registration, bool) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	reg, ok := registry[command]
+	return reg, ok
+}
+
+// Commands returns the sorted list of registered commands.
+func Commands() []string {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	commands := make([]string, 0, len(registry))
+	for command := range registry {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"io"
+	"strings"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Result represents the outcome of a plugin's execution, including the
+// plugin's name, its status and message, additional lines of text and
+// performance data. It can be inspected or rendered independently of the
+// program's termination.
+type Result struct {
+	Name     string
+	Status   Status
+	Message  string
+	Lines    []string
+	PerfData []*perfdata.PerfData
+}
+
+// String generates the result's text output, in the format expected by the
+// monitoring system.
+func (r *Result) String() string {
+	var sb strings.Builder
+	sb.WriteString(r.Name)
+	sb.WriteString(" ")
+	sb.WriteString(r.Status.String())
+	sb.WriteString(": ")
+	sb.WriteString(r.Message)
+	if len(r.PerfData) > 0 {
+		sb.WriteString(" | ")
+		for i, pd := range r.PerfData {
+			if i != 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(pd.String())
+		}
+	}
+	for _, line := range r.Lines {
+		sb.WriteString("\n")
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// Output generates the result's text output without its performance data,
+// i.e. the status line followed by the additional lines of text.
+func (r *Result) Output() string {
+	var sb strings.Builder
+	sb.WriteString(r.Name)
+	sb.WriteString(" ")
+	sb.WriteString(r.Status.String())
+	sb.WriteString(": ")
+	sb.WriteString(r.Message)
+	for _, line := range r.Lines {
+		sb.WriteString("\n")
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// WriteTo writes the result's text output, followed by a new line, to the
+// specified writer.
+func (r *Result) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, r.String()+"\n")
+	return int64(n), err
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+func TestResultString(t *testing.T) {
+	r := &Result{
+		Name:    "Test",
+		Status:  WARNING,
+		Message: "something is odd",
+	}
+	if got, want := r.String(), "Test WARNING: something is odd"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	r.PerfData = []*perfdata.PerfData{
+		perfdata.New("a", perfdata.UOM_SECONDS, "1.5"),
+		perfdata.New("b c", perfdata.UOM_NONE, "2"),
+	}
+	r.Lines = []string{"line 1", "line 2"}
+	want := "Test WARNING: something is odd | a=1.5s;;;;, 'b c'=2;;;;\nline 1\nline 2"
+	if got := r.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResultWriteTo(t *testing.T) {
+	r := &Result{Name: "Test", Status: OK, Message: "fine"}
+	var sb strings.Builder
+	n, err := r.WriteTo(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sb.String(), "Test OK: fine\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if n != int64(sb.Len()) {
+		t.Errorf("reported %d bytes, wrote %d", n, sb.Len())
+	}
+}
+
+func TestPluginResult(t *testing.T) {
+	p := New("Test")
+	if r := p.Result(); r.Status != UNKNOWN || r.Message != "no status set" {
+		t.Errorf("unexpected initial result %v", r)
+	}
+	p.SetState(CRITICAL, "broken")
+	p.AddLine("detail %d", 1)
+	p.AddPerfData(perfdata.New("x", perfdata.UOM_NONE, "1"))
+	r := p.Result()
+	if r.Name != "Test" || r.Status != CRITICAL || r.Message != "broken" {
+		t.Errorf("unexpected result %v", r)
+	}
+	if len(r.Lines) != 1 || r.Lines[0] != "detail 1" {
+		t.Errorf("unexpected lines %v", r.Lines)
+	}
+	if len(r.PerfData) != 1 || r.PerfData[0].Label != "x" {
+		t.Errorf("unexpected performance data %v", r.PerfData)
+	}
+}
+
+// Get the labels of a result's performance data.
+func perfDataLabels(r *Result) []string {
+	labels := make([]string, len(r.PerfData))
+	for i, pd := range r.PerfData {
+		labels[i] = pd.Label
+	}
+	return labels
+}
+
+func TestPerfDataOrder(t *testing.T) {
+	p := New("Test")
+	for _, label := range []string{"c", "a", "d", "b"} {
+		p.AddPerfData(perfdata.New(label, perfdata.UOM_NONE, "1"))
+	}
+	if got, want := strings.Join(perfDataLabels(p.Result()), ","), "c,a,d,b"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	p.SortPerfData(true)
+	if got, want := strings.Join(perfDataLabels(p.Result()), ","), "a,b,c,d"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPerfDataDuplicates(t *testing.T) {
+	p := New("Test")
+	pd := perfdata.New("a", perfdata.UOM_NONE, "1")
+	pd.SetWarn(perfdata.PDRMax("10"))
+	p.AddPerfData(pd)
+	p.AddPerfData(perfdata.New("b", perfdata.UOM_NONE, "2"))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("duplicate performance data did not cause a panic")
+			}
+		}()
+		p.AddPerfData(perfdata.New("a", perfdata.UOM_NONE, "3"))
+	}()
+
+	merged := perfdata.New("a", perfdata.UOM_SECONDS, "4")
+	merged.SetCrit(perfdata.PDRMax("20"))
+	p.MergePerfData(merged)
+	p.SetPerfData(perfdata.New("b", perfdata.UOM_NONE, "5"))
+	p.MergePerfData(perfdata.New("c", perfdata.UOM_NONE, "6"))
+	r := p.Result()
+	want := []string{"a=4s;:10;:20;;", "b=5;;;;", "c=6;;;;"}
+	if len(r.PerfData) != len(want) {
+		t.Fatalf("got %d records, want %d", len(r.PerfData), len(want))
+	}
+	for i := range want {
+		if got := r.PerfData[i].String(); got != want[i] {
+			t.Errorf("record %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"sync"
+)
+
+// RunCheck runs a check in-process and returns its result, instead of
+// printing it and exiting. The arguments, which do not include a program
+// name, may include the standard options, except for help and version and
+// for those that write to files or send the result elsewhere (metrics
+// export, state directory and passive results). If the check panics, the
+// result is UNKNOWN; if its timeout expires, the check is abandoned and the
+// result is generated from whatever information it had collected.
+func RunCheck(name string, check Check, args []string) *Result {
+	p := New(name)
+	p.output = ioutil.Discard
+	exited := make(chan struct{})
+	var exitOnce sync.Once
+	p.exit = func(int) {
+		exitOnce.Do(func() { close(exited) })
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer func() {
+			if r := recover(); r != nil {
+				p.SetState(UNKNOWN, "Internal error")
+				p.AddLine("Error info: %v", r)
+			}
+		}()
+		runArguments(p, check, args)
+	}()
+	select {
+	case <-finished:
+	case <-exited:
+	}
+	r := p.Result()
+	p.Done()
+	return r
+}
+
+// Parse a check's arguments in-process, then validate and run the check.
+func runArguments(p *Plugin, check Check, args []string) {
+	var opts standardOptions
+	flags := &Flags{}
+	opts.declareFlags(flags)
+	check.DeclareFlags(flags)
+	if err := flags.parse(args); err != nil {
+		p.SetState(UNKNOWN, err.Error())
+		return
+	}
+	if opts.help || opts.version {
+		p.SetState(UNKNOWN, "help and version flags are not supported by in-process checks")
+		return
+	}
+	if opts.metricsOut != "" || opts.stateDir != "" || opts.icinga.URL != "" ||
+		opts.nagiosSpool != "" || opts.nagiosCmd != "" {
+		p.SetState(UNKNOWN, "metrics export, state directory and passive result flags are "+
+			"not supported by in-process checks")
+		return
+	}
+	if opts.apply(p, args) && check.CheckFlags(p) {
+		check.Run(p)
+	}
+}
+
+// FlagValueOffsets parses a check's arguments, which may include the
+// standard options, without setting any value. For each argument, it
+// returns the offset at which the value of a flag starts, or -1 if the
+// argument does not contain a value; for example, the offsets of "-H",
+// "example.org" and "--port=443" are -1, 0 and 7, respectively. This
+// allows callers that build arguments from templates to ensure that
+// untrusted data may only be used as flag values.
+func FlagValueOffsets(check Check, args []string) ([]int, error) {
+	var opts standardOptions
+	flags := &Flags{}
+	opts.declareFlags(flags)
+	check.DeclareFlags(flags)
+	return flags.scan(args, func(*flagOption, string) error { return nil })
+}
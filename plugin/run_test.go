@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlagsParse(t *testing.T) {
+	var (
+		b, c bool
+		i, v int
+		s    string
+	)
+	flags := &Flags{}
+	flags.BoolVarP(&b, 'b', "bool", false, "")
+	flags.BoolVarP(&c, 'c', "other-bool", false, "")
+	flags.IntVarP(&i, 'i', "int", 12, "")
+	flags.StringVarP(&s, 's', "string", "default", "")
+	flags.CountVarP(&v, 'v', "verbose", "")
+	tests := []struct {
+		args []string
+		b, c bool
+		i, v int
+		s    string
+	}{
+		{nil, false, false, 12, 0, "default"},
+		{[]string{"--bool", "--int", "3", "--string=x=y"}, true, false, 3, 0, "x=y"},
+		{[]string{"-bc", "-i4", "-s", "value"}, true, true, 4, 0, "value"},
+		{[]string{"-bs", "value", "--bool=false"}, false, false, 12, 0, "value"},
+		{[]string{"-i", "-1", "--"}, false, false, -1, 0, "default"},
+		{[]string{"-vv", "--verbose", "-bv"}, true, false, 12, 4, "default"},
+		{[]string{"-vs", "-v", "-v"}, false, false, 12, 2, "-v"},
+		{[]string{"--string", "--verbose"}, false, false, 12, 0, "--verbose"},
+	}
+	for _, test := range tests {
+		if err := flags.parse(test.args); err != nil {
+			t.Errorf("%q: unexpected error %v", test.args, err)
+			continue
+		}
+		if b != test.b || c != test.c || i != test.i || v != test.v || s != test.s {
+			t.Errorf("%q: got %v %v %d %d %q", test.args, b, c, i, v, s)
+		}
+	}
+	for _, args := range [][]string{
+		{"--unknown"},
+		{"-x"},
+		{"--int", "abc"},
+		{"--string"},
+		{"-i"},
+		{"positional"},
+		{"--", "positional"},
+		{"--bool=maybe"},
+		{"--verbose=2"},
+	} {
+		if err := flags.parse(args); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
+
+// A check used to test in-process execution.
+type testCheck struct {
+	message string
+	delay   int
+	fail    bool
+}
+
+func (c *testCheck) DeclareFlags(flags *Flags) {
+	flags.StringVarP(&c.message, 'm', "message", "", "Message")
+	flags.IntVar(&c.delay, "delay", 0, "Delay in milliseconds")
+	flags.BoolVar(&c.fail, "panic", false, "Panic while running")
+}
+
+func (c *testCheck) CheckFlags(p *Plugin) bool {
+	if c.message == "" {
+		p.SetState(UNKNOWN, "no message")
+		return false
+	}
+	return true
+}
+
+func (c *testCheck) Run(p *Plugin) {
+	p.Log(VERBOSE_INFO, "running")
+	p.SetState(OK, c.message)
+	if c.fail {
+		panic("failure")
+	}
+	time.Sleep(time.Duration(c.delay) * time.Millisecond)
+}
+
+func TestRunCheck(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-m", "fine"}, "Test OK: fine"},
+		{[]string{"-v", "--message=fine"}, "Test OK: fine\nrunning"},
+		{[]string{"-vm", "fine"}, "Test OK: fine\nrunning"},
+		{[]string{"-m", "-v"}, "Test OK: -v"},
+		{nil, "Test UNKNOWN: no message"},
+		{[]string{"-m", "fine", "extra"}, "Test UNKNOWN: unexpected argument 'extra'"},
+		{[]string{"-h"}, "Test UNKNOWN: help and version flags are not supported by in-process checks"},
+		{[]string{"-m", "x", "--panic"}, "Test UNKNOWN: Internal error\nError info: failure"},
+		{[]string{"-m", "slow", "--delay", "5000", "-t", "1"}, "Test UNKNOWN: check timed out after 1s\nslow"},
+		{[]string{"-m", "x", "--metrics-output", "/tmp/metrics"}, "Test UNKNOWN: metrics export, " +
+			"state directory and passive result flags are not supported by in-process checks"},
+		{[]string{"-m", "x", "--nagios-spool=/tmp", "--nagios-host=h"}, "Test UNKNOWN: metrics export, " +
+			"state directory and passive result flags are not supported by in-process checks"},
+	}
+	for _, test := range tests {
+		got := RunCheck("Test", &testCheck{}, test.args).String()
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestFlagValueOffsets(t *testing.T) {
+	offsets, err := FlagValueOffsets(&testCheck{}, []string{
+		"-vv", "-m", "$ARG1$", "--message=$ARG2$", "-m$ARG3$", "--panic", "--delay", "5", "-t", "1",
+		"-vm$ARG4$"})
+	want := []int{-1, -1, 0, 10, 2, -1, -1, 0, -1, 0, 3}
+	if err != nil || !reflect.DeepEqual(offsets, want) {
+		t.Errorf("got %v, %v, want %v", offsets, err, want)
+	}
+	if _, err := FlagValueOffsets(&testCheck{}, []string{"-m", "x", "$ARG1$"}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	Register("check_registry_test", "Test", func() Check { return &testCheck{} })
+	reg, ok := Lookup("check_registry_test")
+	if !ok || reg.Name != "Test" || reg.New == nil {
+		t.Fatalf("unexpected registration %+v", reg)
+	}
+	if _, ok := Lookup("check_missing"); ok {
+		t.Errorf("found unregistered check")
+	}
+	if !strings.Contains(strings.Join(Commands(), ","), "check_registry_test") {
+		t.Errorf("check missing from %v", Commands())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate registration did not cause a panic")
+		}
+	}()
+	Register("check_registry_test", "Test", func() Check { return &testCheck{} })
+}
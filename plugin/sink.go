@@ -0,0 +1,17 @@
+package plugin
+
+// Sink is implemented by destinations to which a plugin's result may be
+// submitted instead of being written to the standard output, for example
+// in order to feed passive check results to the monitoring system.
+type Sink interface {
+	// Submit sends the result to the destination.
+	Submit(r *Result) error
+}
+
+// SetSink sets the destination to which the plugin's result will be
+// submitted when Done is called.
+func (p *Plugin) SetSink(sink Sink) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sink = sink
+}
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// StateDirEnv is the name of the environment variable that may be used to
+// select the directory in which checks store their state.
+const StateDirEnv = "MONITORING_PLUGIN_STATE_DIR"
+
+// Delay between attempts to lock a state file.
+const stateLockRetry = 50 * time.Millisecond
+
+// Get the default state directory, which is read from the environment or
+// is a subdirectory of the user's cache directory. If the latter cannot be
+// determined, a per-user subdirectory of the system's temporary directory is
+// used.
+func defaultStateDir() string {
+	if dir := os.Getenv(StateDirEnv); dir != "" {
+		return dir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "monitoring-plugins")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("monitoring-plugins-%d", os.Getuid()))
+}
+
+// StateStore is a directory in which checks may store values that they need
+// to compare with during their next run. Each check's state is identified by
+// the check's name and arguments.
+type StateStore struct {
+	dir string
+}
+
+// NewStateStore creates a state store that uses the specified directory,
+// which will be created if necessary. As other users could tamper with the
+// state or lock it, the directory must belong to the current user and must
+// not be writable by other users.
+func NewStateStore(dir string) *StateStore {
+	return &StateStore{dir: dir}
+}
+
+// Regexp that matches characters that are removed from check names when
+// generating state file names.
+var stateNameInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Generate the base name of the state file for a check's name and arguments.
+// The name is made readable, while a hash of both the name and the arguments
+// ensures that it is unique.
+func stateFileName(name string, args []string) string {
+	hash := sha256.New()
+	hash.Write([]byte(name))
+	for _, arg := range args {
+		hash.Write([]byte{0})
+		hash.Write([]byte(arg))
+	}
+	readable := strings.Trim(stateNameInvalid.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	return fmt.Sprintf("%s-%s", readable, hex.EncodeToString(hash.Sum(nil))[:16])
+}
+
+// Open opens the state of the check identified by a name and its arguments,
+// acquiring an exclusive lock on it. If another process holds the lock, Open
+// waits until it is released or until the context is cancelled. The state
+// must be closed in order to release the lock.
+func (s *StateStore) Open(ctx context.Context, name string, args []string) (*StateFile, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create state directory: %w", err)
+	}
+	if err := checkStateDir(s.dir); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(s.dir, stateFileName(name, args))
+	lockFile, err := os.OpenFile(base+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open state lock: %w", err)
+	}
+	for {
+		locked, err := tryLockFile(lockFile)
+		if err != nil {
+			lockFile.Close()
+			return nil, fmt.Errorf("could not lock state: %w", err)
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			lockFile.Close()
+			return nil, fmt.Errorf("could not lock state: %w", ctx.Err())
+		case <-time.After(stateLockRetry):
+		}
+	}
+	return &StateFile{
+		path:     base + ".json",
+		lockFile: lockFile,
+	}, nil
+}
+
+// StateFile is a check's locked state, which can be loaded and saved as a
+// JSON document.
+type StateFile struct {
+	path     string
+	lockFile *os.File
+}
+
+// Load reads the state into the specified value. It returns false if no
+// state has been saved yet.
+func (f *StateFile) Load(v interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not read state: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("could not decode state: %w", err)
+	}
+	return true, nil
+}
+
+// Save writes the specified value as the state. The data is written to a
+// temporary file which then replaces the state file, so that the state is
+// never left partially written.
+func (f *StateFile) Save(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode state: %w", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("could not write state: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write state: %w", err)
+	}
+	return nil
+}
+
+// Close releases the lock on the state.
+func (f *StateFile) Close() error {
+	return f.lockFile.Close()
+}
+
+// SetStateStore sets the store in which the plugin's state is kept, as well
+// as the arguments that identify the check's state along with the plugin's
+// name.
+func (p *Plugin) SetStateStore(store *StateStore, args []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stateStore = store
+	p.stateArgs = args
+}
+
+// OpenState opens and locks the check's state. Waiting for the lock is
+// interrupted if the plugin's timeout expires. If no store has been set, a
+// store in the default directory is used.
+func (p *Plugin) OpenState() (*StateFile, error) {
+	return p.OpenNamedState("")
+}
+
+// OpenNamedState opens and locks a named state of the check, which is
+// separate from its main state. This allows helpers to store their own data
+// without interfering with the check's state.
+func (p *Plugin) OpenNamedState(section string) (*StateFile, error) {
+	p.lock.Lock()
+	store, name, args, ctx := p.stateStore, p.name, p.stateArgs, p.context()
+	p.lock.Unlock()
+	if store == nil {
+		store = NewStateStore(defaultStateDir())
+	}
+	if section != "" {
+		name = name + "/" + section
+	}
+	return store.Open(ctx, name, args)
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Ensure that the state directory belongs to the current user and cannot be
+// written to by other users.
+func checkStateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("could not check state directory: %w", err)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("state directory %s does not belong to the current user", dir)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("state directory %s is writable by other users", dir)
+	}
+	return nil
+}
+
+// Try to acquire an exclusive lock on a file without blocking. Returns false
+// if the file is locked by another process.
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
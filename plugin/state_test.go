@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type testState struct {
+	Serial  uint32 `json:"serial"`
+	Changed int64  `json:"changed"`
+}
+
+func TestStateFileName(t *testing.T) {
+	a := stateFileName("DNS zone serial check", []string{"-H", "ns1", "-z", "example.org"})
+	b := stateFileName("DNS zone serial check", []string{"-H", "ns1", "-z", "example.com"})
+	c := stateFileName("DNS zone serial check", []string{"-H", "ns1", "-z example.org"})
+	if a == b || a == c || b == c {
+		t.Errorf("state file names are not unique: %s %s %s", a, b, c)
+	}
+	if want := "dns_zone_serial_check-"; a[:len(want)] != want {
+		t.Errorf("unexpected state file name %s", a)
+	}
+}
+
+func TestStateSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStateStore(dir)
+	args := []string{"-H", "host"}
+
+	f, err := store.Open(context.Background(), "Test", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state testState
+	if found, err := f.Load(&state); err != nil || found {
+		t.Fatalf("unexpected state: %v %v", found, err)
+	}
+	if err := f.Save(&testState{Serial: 12, Changed: 1600000000}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	p := New("Test")
+	p.SetStateStore(store, args)
+	f, err = p.OpenState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if found, err := f.Load(&state); err != nil || !found {
+		t.Fatalf("state not found: %v", err)
+	}
+	if state.Serial != 12 || state.Changed != 1600000000 {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("expected a state file and a lock file, got %d files", len(files))
+	}
+}
+
+func TestStateLock(t *testing.T) {
+	store := NewStateStore(t.TempDir())
+	f, err := store.Open(context.Background(), "Test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if _, err := store.Open(ctx, "Test", nil); err == nil {
+		t.Fatalf("state was locked twice")
+	}
+
+	other, err := store.Open(context.Background(), "Test", []string{"other"})
+	if err != nil {
+		t.Fatalf("could not open another check's state: %v", err)
+	}
+	other.Close()
+
+	go func(f *StateFile) {
+		time.Sleep(100 * time.Millisecond)
+		f.Close()
+	}(f)
+	again, err := store.Open(context.Background(), "Test", nil)
+	if err != nil {
+		t.Fatalf("could not lock state after release: %v", err)
+	}
+	again.Close()
+}
+
+func TestStateDirPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("state directory permissions are not checked on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "shared")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := NewStateStore(dir).Open(context.Background(), "Test", nil); err == nil {
+		f.Close()
+		t.Errorf("state opened in a directory writable by other users")
+	}
+
+	created := filepath.Join(t.TempDir(), "created")
+	f, err := NewStateStore(created).Open(context.Background(), "Test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if info, err := os.Stat(created); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("unexpected state directory mode %v, %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// File ownership cannot be checked on Windows, where the state directory's
+// access control is left to the system's defaults.
+func checkStateDir(dir string) error {
+	return nil
+}
+
+// LockFileEx is not wrapped by the version of golang.org/x/sys that is used,
+// so it is loaded from kernel32.dll.
+var procLockFileEx = windows.NewLazySystemDLL("kernel32.dll").NewProc("LockFileEx")
+
+// Flags of LockFileEx.
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+)
+
+// Try to acquire an exclusive lock on a file without blocking. Returns false
+// if the file is locked by another process. The lock is released when the
+// file is closed.
+func tryLockFile(f *os.File) (bool, error) {
+	if err := procLockFileEx.Find(); err != nil {
+		return false, err
+	}
+	var overlapped windows.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0,
+		1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r != 0 {
+		return true, nil
+	}
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"fmt"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+// Thresholds combines the optional warning and critical ranges that are used
+// to compute a plugin's status from a value.
+type Thresholds struct {
+	Warn *perfdata.PerfDataRange
+	Crit *perfdata.PerfDataRange
+}
+
+// ParseThresholds creates thresholds from the specified warning and critical
+// ranges, using the standard Nagios threshold syntax. An empty string means
+// that the corresponding range is not set.
+func ParseThresholds(warn, crit string) (Thresholds, error) {
+	var (
+		t   Thresholds
+		err error
+	)
+	if warn != "" {
+		if t.Warn, err = perfdata.ParseRange(warn); err != nil {
+			return Thresholds{}, err
+		}
+	}
+	if crit != "" {
+		if t.Crit, err = perfdata.ParseRange(crit); err != nil {
+			return Thresholds{}, err
+		}
+	}
+	return t, nil
+}
+
+// Evaluate checks a value against the thresholds and returns the resulting
+// status. If `pd` is not nil, the ranges that are set will be attached to it
+// as its warning and critical ranges.
+func (t Thresholds) Evaluate(value float64, pd *perfdata.PerfData) Status {
+	if pd != nil {
+		if t.Warn != nil {
+			pd.SetWarn(t.Warn)
+		}
+		if t.Crit != nil {
+			pd.SetCrit(t.Crit)
+		}
+	}
+	if t.Crit != nil && t.Crit.Alert(value) {
+		return CRITICAL
+	}
+	if t.Warn != nil && t.Warn.Alert(value) {
+		return WARNING
+	}
+	return OK
+}
+
+// String generates a description of the thresholds.
+func (t Thresholds) String() string {
+	warn, crit := "none", "none"
+	if t.Warn != nil {
+		warn = t.Warn.String()
+	}
+	if t.Crit != nil {
+		crit = t.Crit.String()
+	}
+	return fmt.Sprintf("warning range %s, critical range %s", warn, crit)
+}
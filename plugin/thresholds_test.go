@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"testing"
+
+	"nocternity.net/go/monitoring/perfdata"
+)
+
+func TestThresholdsEvaluate(t *testing.T) {
+	th, err := ParseThresholds("10:", "5:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value float64
+		want  Status
+	}{
+		{20, OK},
+		{10, OK},
+		{9, WARNING},
+		{5, WARNING},
+		{4.9, CRITICAL},
+	}
+	for _, test := range tests {
+		if got := th.Evaluate(test.value, nil); got != test.want {
+			t.Errorf("%v: got %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestThresholdsPerfData(t *testing.T) {
+	th, err := ParseThresholds("", "@0:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd := perfdata.New("x", perfdata.UOM_NONE, "2")
+	if got := th.Evaluate(2, pd); got != CRITICAL {
+		t.Errorf("got %v, want %v", got, CRITICAL)
+	}
+	if got, want := pd.String(), "x=2;;@:3;;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := th.String(), "warning range none, critical range @:3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseThresholdsError(t *testing.T) {
+	if _, err := ParseThresholds("10", "x"); err == nil {
+		t.Errorf("expected an error")
+	}
+	if th, err := ParseThresholds("", ""); err != nil || th.Warn != nil || th.Crit != nil {
+		t.Errorf("unexpected result %v, %v", th, err)
+	}
+}
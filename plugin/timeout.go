@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delay between the expiration of the timeout and the forced termination of
+// the plugin. This gives network operations that use the plugin's context a
+// chance to fail and report the failure.
+const timeoutGrace = 500 * time.Millisecond
+
+// ParseTimeout reads a timeout specification, which is either a number of
+// seconds or a number of seconds followed by a colon and the name of the
+// state to use if the timeout expires (e.g. "10:critical"). The default
+// state is UNKNOWN.
+func ParseTimeout(spec string) (time.Duration, Status, error) {
+	seconds, stateName := spec, ""
+	sep := strings.IndexByte(spec, ':')
+	if sep != -1 {
+		seconds, stateName = spec[:sep], spec[sep+1:]
+	}
+	n, err := strconv.ParseUint(seconds, 10, 32)
+	if err != nil || n == 0 {
+		return 0, UNKNOWN, fmt.Errorf("invalid timeout '%s'", spec)
+	}
+	state := UNKNOWN
+	if sep != -1 {
+		state, err = ParseStatus(strings.ToUpper(stateName))
+		if err != nil {
+			return 0, UNKNOWN, fmt.Errorf("invalid timeout state '%s'", stateName)
+		}
+	}
+	return time.Duration(n) * time.Second, state, nil
+}
+
+// SetTimeout sets the plugin's execution timeout and the state it will end
+// in if the timeout expires. The plugin's context will be cancelled when the
+// timeout expires; if Done has not been called shortly afterwards, it will
+// be called automatically, generating the output using whatever information
+// has been collected so far. Setting the timeout again replaces the previous
+// timeout.
+func (p *Plugin) SetTimeout(timeout time.Duration, state Status) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stopTimeout()
+	p.timeoutCtx, p.timeoutStop = context.WithTimeout(p.ctx, timeout)
+	p.timeout = timeout
+	p.timeoutState = state
+	p.timer = time.AfterFunc(timeout+timeoutGrace, p.Done)
+}
+
+// Stop the timer that calls Done and release the timeout's context, if a
+// timeout has been set. The lock must be held by the caller.
+func (p *Plugin) stopTimeout() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if p.timeoutStop != nil {
+		p.timeoutStop()
+		p.timeoutStop = nil
+	}
+}
+
+// Release the plugin's contexts and timer once its output has been
+// generated, so that plugins that are run in-process do not linger.
+func (p *Plugin) release() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stopTimeout()
+	p.cancel()
+}
+
+// Get the plugin's current context, which is the timeout's context if a
+// timeout has been set. The lock must be held by the caller.
+func (p *Plugin) context() context.Context {
+	if p.timeoutCtx != nil {
+		return p.timeoutCtx
+	}
+	return p.ctx
+}
+
+// Context returns the plugin's context. It is cancelled when the plugin's
+// timeout expires, and should be used by all network operations.
+func (p *Plugin) Context() context.Context {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.context()
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		spec    string
+		timeout time.Duration
+		state   Status
+	}{
+		{"10", 10 * time.Second, UNKNOWN},
+		{"5:critical", 5 * time.Second, CRITICAL},
+		{"30:WARNING", 30 * time.Second, WARNING},
+		{"1:ok", time.Second, OK},
+	}
+	for _, test := range tests {
+		timeout, state, err := ParseTimeout(test.spec)
+		if err != nil || timeout != test.timeout || state != test.state {
+			t.Errorf("%q: got %v, %v, %v", test.spec, timeout, state, err)
+		}
+	}
+	for _, spec := range []string{"", "0", "-1", "abc", "10:", "10:bad"} {
+		if _, _, err := ParseTimeout(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	var sb strings.Builder
+	exited := make(chan int, 1)
+	p := New("Test")
+	p.output = &sb
+	p.exit = func(code int) { exited <- code }
+	p.SetTimeout(10*time.Millisecond, CRITICAL)
+	p.AddLine("partial information")
+	p.SetState(OK, "first step done")
+
+	select {
+	case <-p.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("context was not cancelled")
+	}
+	select {
+	case code := <-exited:
+		if code != int(CRITICAL) {
+			t.Errorf("got exit code %d, want %d", code, CRITICAL)
+		}
+	case <-time.After(time.Second + timeoutGrace):
+		t.Fatal("Done was not called")
+	}
+	want := "Test ERROR: check timed out after 10ms\nfirst step done\npartial information\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Further calls to Done must not generate more output.
+	p.Done()
+	if got := sb.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTimeoutReleased(t *testing.T) {
+	var sb strings.Builder
+	p := New("Test")
+	p.output = &sb
+	p.exit = func(int) {}
+	p.SetTimeout(time.Hour, CRITICAL)
+	first := p.Context()
+	p.SetTimeout(2*time.Hour, CRITICAL)
+	if first.Err() == nil {
+		t.Errorf("context of the replaced timeout was not cancelled")
+	}
+	p.SetState(OK, "fine")
+	p.Done()
+	if want := "Test OK: fine\n"; sb.String() != want {
+		t.Errorf("got %q, want %q", sb.String(), want)
+	}
+	if p.timer != nil || p.Context().Err() == nil {
+		t.Errorf("timer or context not released by Done")
+	}
+}
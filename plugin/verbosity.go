@@ -0,0 +1,37 @@
+package plugin
+
+import (
+	"fmt"
+)
+
+// Verbosity levels, as defined by the Nagios plugin development guidelines.
+const (
+	// Single line of output, minimal information.
+	VERBOSE_NONE = iota
+	// Additional information, e.g. details about the items that failed.
+	VERBOSE_INFO
+	// Configuration debugging information, e.g. the commands or requests
+	// used by the check.
+	VERBOSE_CONFIG
+	// Plugin problem diagnosis, e.g. raw responses from the monitored
+	// service.
+	VERBOSE_DEBUG
+)
+
+// Log writes a message if the plugin's verbosity is at least `level`. The
+// messages of the VERBOSE_INFO and VERBOSE_CONFIG levels are added to the
+// output text, while VERBOSE_DEBUG messages, which may be very long, are
+// written to the standard error stream.
+func (p *Plugin) Log(level int, format string, data ...interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if level > p.verbosity {
+		return
+	}
+	message := fmt.Sprintf(format, data...)
+	if level >= VERBOSE_DEBUG {
+		fmt.Fprintln(p.errOutput, message)
+	} else {
+		p.addLine(message)
+	}
+}
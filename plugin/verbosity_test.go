@@ -0,0 +1,37 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	tests := []struct {
+		verbosity int
+		lines     []string
+		stderr    string
+	}{
+		{VERBOSE_NONE, nil, ""},
+		{VERBOSE_INFO, []string{"info 1"}, ""},
+		{VERBOSE_CONFIG, []string{"info 1", "config 2"}, ""},
+		{VERBOSE_DEBUG, []string{"info 1", "config 2"}, "debug 3\n"},
+		{VERBOSE_DEBUG + 1, []string{"info 1", "config 2"}, "debug 3\n"},
+	}
+	for _, test := range tests {
+		var sb strings.Builder
+		p := New("Test")
+		p.errOutput = &sb
+		p.SetVerbosity(test.verbosity)
+		p.SetState(OK, "fine")
+		p.Log(VERBOSE_INFO, "info %d", 1)
+		p.Log(VERBOSE_CONFIG, "config %d", 2)
+		p.Log(VERBOSE_DEBUG, "debug %d", 3)
+		if r := p.Result(); !reflect.DeepEqual(r.Lines, test.lines) {
+			t.Errorf("verbosity %d: got lines %q, want %q", test.verbosity, r.Lines, test.lines)
+		}
+		if got := sb.String(); got != test.stderr {
+			t.Errorf("verbosity %d: got %q on stderr, want %q", test.verbosity, got, test.stderr)
+		}
+	}
+}